@@ -0,0 +1,428 @@
+package mockhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Redacted is the value which replaces redacted values (e.g. secret headers) in recorded interactions
+const Redacted = "REDACTED"
+
+// defaultRedactedHeaders are the headers which are redacted by default, as they usually hold secrets (see
+// UnredactHeaders)
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Cassette holds interactions (request / response pairs) recorded against a real upstream service, to be saved to a
+// file and later replayed by mock servers and clients (record and replay, a.k.a. VCR mode). Safe for concurrent use.
+//
+// To record, use a recording endpoint, which proxies requests to the real upstream and records the interactions:
+//   cassette := NewCassette(RedactHeaders("X-Api-Key"))
+//   client := NewClient(cassette.RecordingClientEndpoint(http.DefaultTransport))
+//   // or: server := StartServer(WithEndpoints(cassette.RecordingServerEndpoint(upstreamURL)))
+//   ... // send requests using the client (or to the server)
+//   err := cassette.Save("testdata/cassette.json")
+// To replay, load the cassette and use its interactions as endpoints:
+//   cassette, err := LoadCassette("testdata/cassette.json", MatchBody())
+//   client := NewClient(cassette.ClientEndpoints()...)
+//   // or: server := StartServer(WithEndpoints(cassette.ServerEndpoints()...))
+type Cassette struct {
+	mtx             sync.Mutex
+	interactions    []Interaction
+	matchQuery      bool
+	matchBody       bool
+	matchHeaders    []string
+	redactHeaders   []string
+	unredactHeaders []string
+	redactQuery     []string
+	redactors       []func(*Interaction)
+}
+
+// Interaction is a request and the response received for it, as recorded in a cassette
+type Interaction struct {
+	Request  InteractionRequest  `json:"request"`
+	Response InteractionResponse `json:"response"`
+}
+
+// InteractionRequest is a recorded request of an interaction
+type InteractionRequest struct {
+	Method string `json:"method"`
+	// URL is the request URL. For requests recorded by a server, only the path and query.
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	// BodyEncoding is "base64" if the body is not a valid UTF-8 text, and is base64 encoded
+	BodyEncoding string `json:"body_encoding,omitempty"`
+}
+
+// InteractionResponse is a recorded response of an interaction
+type InteractionResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// BodyEncoding is "base64" if the body is not a valid UTF-8 text, and is base64 encoded
+	BodyEncoding string `json:"body_encoding,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// CassetteOpt is a functional option for configuring a cassette
+type CassetteOpt func(*Cassette)
+
+// MatchQuery is a cassette functional option, to replay an interaction only for requests with the same query
+// parameters. By default, interactions are replayed for requests with the same method and path.
+//
+// Query parameters which were redacted when recording are not matched, as their real values are not known.
+func MatchQuery() CassetteOpt {
+	return func(c *Cassette) {
+		c.matchQuery = true
+	}
+}
+
+// MatchBody is a cassette functional option, to replay an interaction only for requests with the same body. By default,
+// interactions are replayed for requests with the same method and path.
+func MatchBody() CassetteOpt {
+	return func(c *Cassette) {
+		c.matchBody = true
+	}
+}
+
+// MatchHeaders is a cassette functional option, to replay an interaction only for requests with the same values of the
+// given headers. By default, interactions are replayed for requests with the same method and path.
+//
+// Headers which were redacted when recording are not matched, as their real values are not known.
+func MatchHeaders(keys ...string) CassetteOpt {
+	return func(c *Cassette) {
+		c.matchHeaders = append(c.matchHeaders, keys...)
+	}
+}
+
+// RedactHeaders is a cassette functional option, to redact the values of the given headers (of both requests and
+// responses) when recording interactions. The Authorization, Proxy-Authorization, Cookie and Set-Cookie headers are
+// always redacted, unless explicitly excluded using UnredactHeaders.
+func RedactHeaders(keys ...string) CassetteOpt {
+	return func(c *Cassette) {
+		c.redactHeaders = append(c.redactHeaders, keys...)
+	}
+}
+
+// UnredactHeaders is a cassette functional option, to record the values of the given headers as is, even if they are
+// redacted by default (see RedactHeaders). Make sure the recorded values are not secret, as cassettes are usually
+// committed along with the tests.
+func UnredactHeaders(keys ...string) CassetteOpt {
+	return func(c *Cassette) {
+		c.unredactHeaders = append(c.unredactHeaders, keys...)
+	}
+}
+
+// RedactQuery is a cassette functional option, to redact the values of the given request query parameters when
+// recording interactions
+func RedactQuery(keys ...string) CassetteOpt {
+	return func(c *Cassette) {
+		c.redactQuery = append(c.redactQuery, keys...)
+	}
+}
+
+// RedactWith is a cassette functional option, to redact recorded interactions using the given function, e.g. to remove
+// secrets from bodies. Called for each interaction when it is recorded, after any other redaction.
+func RedactWith(redactor func(interaction *Interaction)) CassetteOpt {
+	return func(c *Cassette) {
+		c.redactors = append(c.redactors, redactor)
+	}
+}
+
+// NewCassette creates a new empty cassette, to record interactions
+func NewCassette(opts ...CassetteOpt) *Cassette {
+	c := &Cassette{
+		interactions:  []Interaction{},
+		redactHeaders: append([]string{}, defaultRedactedHeaders...),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// LoadCassette loads a cassette from the given file, as saved by Cassette.Save
+func LoadCassette(path string, opts ...CassetteOpt) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load cassette: %v", err)
+	}
+	file := cassetteFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not load cassette '%s': %v", path, err)
+	}
+	c := NewCassette(opts...)
+	for _, interaction := range file.Interactions {
+		// empty headers are omitted from the file
+		if interaction.Request.Header == nil {
+			interaction.Request.Header = http.Header{}
+		}
+		if interaction.Response.Header == nil {
+			interaction.Response.Header = http.Header{}
+		}
+		c.interactions = append(c.interactions, interaction)
+	}
+	return c, nil
+}
+
+// Save saves the recorded interactions to the given file (as JSON), creating parent directories as needed
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(cassetteFile{Interactions: c.Interactions()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not save cassette: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not save cassette: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("could not save cassette: %v", err)
+	}
+	return nil
+}
+
+// Interactions returns the interactions of this cassette, in the order they were recorded
+func (c *Cassette) Interactions() []Interaction {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	res := make([]Interaction, len(c.interactions))
+	copy(res, c.interactions)
+	return res
+}
+
+// RecordingClientEndpoint returns a client endpoint which sends requests to the real upstream using the given round
+// tripper (e.g. http.DefaultTransport), and records the interactions. Matches any request by default.
+func (c *Cassette) RecordingClientEndpoint(upstream http.RoundTripper) *clientEndpoint {
+	return NewClientEndpoint().HandleWith(func(request *http.Request) (*http.Response, error) {
+		body := readRequestBody(request)
+		response, err := upstream.RoundTrip(request)
+		if err != nil {
+			return nil, err
+		}
+		responseBody, err := ioutil.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+		c.record(request.Method, request.URL.String(), request.Header, body, response.StatusCode, response.Header, responseBody)
+		return response, nil
+	})
+}
+
+// RecordingServerEndpoint returns a server endpoint which acts as a reverse proxy to the real upstream at the given URL,
+// and records the interactions. Matches any request by default.
+func (c *Cassette) RecordingServerEndpoint(upstream *url.URL) *serverEndpoint {
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	proxy.ModifyResponse = func(upstreamResponse *http.Response) error {
+		responseBody, err := ioutil.ReadAll(upstreamResponse.Body)
+		_ = upstreamResponse.Body.Close()
+		if err != nil {
+			return err
+		}
+		upstreamResponse.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+		// the proxied request is a copy of the received request, which is recorded as received
+		if request, ok := upstreamResponse.Request.Context().Value(proxiedRequestKey{}).(*proxiedRequest); ok {
+			c.record(request.method, request.requestURI, request.header, request.body, upstreamResponse.StatusCode, upstreamResponse.Header, responseBody)
+		}
+		return nil
+	}
+	return NewServerEndpoint().HandleWith(func(response http.ResponseWriter, request *http.Request) {
+		received := &proxiedRequest{
+			method:     request.Method,
+			requestURI: request.URL.RequestURI(),
+			header:     request.Header.Clone(),
+			body:       readRequestBody(request),
+		}
+		proxy.ServeHTTP(response, request.WithContext(context.WithValue(request.Context(), proxiedRequestKey{}, received)))
+	})
+}
+
+type proxiedRequestKey struct{}
+
+// proxiedRequest is a request received by a recording server endpoint, as it is recorded
+type proxiedRequest struct {
+	method     string
+	requestURI string
+	header     http.Header
+	body       []byte
+}
+
+func (c *Cassette) record(method, url string, header http.Header, body []byte, statusCode int, responseHeader http.Header, responseBody []byte) {
+	interaction := Interaction{
+		Request: InteractionRequest{
+			Method: method,
+			URL:    url,
+			Header: header.Clone(),
+		},
+		Response: InteractionResponse{
+			StatusCode: statusCode,
+			Header:     responseHeader.Clone(),
+		},
+	}
+	interaction.Request.Body, interaction.Request.BodyEncoding = encodeBody(body)
+	interaction.Response.Body, interaction.Response.BodyEncoding = encodeBody(responseBody)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.redact(&interaction)
+	c.interactions = append(c.interactions, interaction)
+}
+
+func (c *Cassette) redact(interaction *Interaction) {
+	unredacted := map[string]bool{}
+	for _, key := range c.unredactHeaders {
+		unredacted[http.CanonicalHeaderKey(key)] = true
+	}
+	for _, key := range c.redactHeaders {
+		if unredacted[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		redactHeader(interaction.Request.Header, key)
+		redactHeader(interaction.Response.Header, key)
+	}
+	if len(c.redactQuery) > 0 {
+		if u, err := url.Parse(interaction.Request.URL); err == nil {
+			query := u.Query()
+			for _, key := range c.redactQuery {
+				if _, ok := query[key]; ok {
+					query.Set(key, Redacted)
+				}
+			}
+			u.RawQuery = query.Encode()
+			interaction.Request.URL = u.String()
+		}
+	}
+	for _, redactor := range c.redactors {
+		redactor(interaction)
+	}
+}
+
+func redactHeader(header http.Header, key string) {
+	if header.Get(key) != "" {
+		header.Set(key, Redacted)
+	}
+}
+
+// ClientEndpoints returns client endpoints which replay the recorded interactions.
+//
+// Each endpoint matches requests according to the matching options of this cassette. Interactions recorded for
+// matching requests are replayed in sequence, the last one repeats once all are used.
+func (c *Cassette) ClientEndpoints() []ClientEndpoint {
+	res := []ClientEndpoint{}
+	c.replay(func(matcher *requestMatcher, responses []*response) {
+		res = append(res, NewClientEndpoint().When(matcher).RespondInSequence(responses...))
+	})
+	return res
+}
+
+// ServerEndpoints returns server endpoints which replay the recorded interactions.
+//
+// Each endpoint matches requests according to the matching options of this cassette. Interactions recorded for
+// matching requests are replayed in sequence, the last one repeats once all are used.
+func (c *Cassette) ServerEndpoints() []ServerEndpoint {
+	res := []ServerEndpoint{}
+	c.replay(func(matcher *requestMatcher, responses []*response) {
+		res = append(res, NewServerEndpoint().When(matcher).RespondInSequence(responses...))
+	})
+	return res
+}
+
+// replay groups the interactions by the request matcher matching them, and calls the given function for each group, in
+// the order the groups were first recorded
+func (c *Cassette) replay(endpoint func(matcher *requestMatcher, responses []*response)) {
+	keys := []string{}
+	matchers := map[string]*requestMatcher{}
+	responses := map[string][]*response{}
+	for _, interaction := range c.Interactions() {
+		matcher, key := c.replayMatcher(interaction.Request)
+		if _, ok := matchers[key]; !ok {
+			keys = append(keys, key)
+			matchers[key] = matcher
+		}
+		responses[key] = append(responses[key], replayResponse(interaction.Response))
+	}
+	for _, key := range keys {
+		endpoint(matchers[key], responses[key])
+	}
+}
+
+// replayMatcher returns the request matcher of a recorded request, according to the matching options, along with a key
+// which identifies it
+func (c *Cassette) replayMatcher(request InteractionRequest) (*requestMatcher, string) {
+	u, err := url.Parse(request.URL)
+	if err != nil {
+		u = &url.URL{Path: request.URL}
+	}
+	matcher := Request().Method(request.Method).Path(u.Path)
+	key := []string{request.Method, u.Path}
+	if c.matchQuery {
+		query := u.Query()
+		for _, k := range sortedKeys(query) {
+			value := query.Get(k)
+			if value == Redacted {
+				// the real value is not known, so it cannot be matched
+				continue
+			}
+			matcher.Query(k, value)
+		}
+		key = append(key, query.Encode())
+	}
+	if c.matchBody {
+		body := decodeBody(request.Body, request.BodyEncoding)
+		matcher.Body(body)
+		key = append(key, string(body))
+	}
+	for _, k := range c.matchHeaders {
+		value := request.Header.Get(k)
+		if value == Redacted {
+			// the real value is not known, so it cannot be matched
+			continue
+		}
+		matcher.Header(k, value)
+		key = append(key, k+": "+value)
+	}
+	return matcher, strings.Join(key, "\x00")
+}
+
+func replayResponse(recorded InteractionResponse) *response {
+	r := Response().StatusCode(recorded.StatusCode).Body(decodeBody(recorded.Body, recorded.BodyEncoding))
+	for key, values := range recorded.Header {
+		// the body may be modified by redaction, so its length and encoding are set when the response is sent
+		if len(values) == 0 || http.CanonicalHeaderKey(key) == "Content-Length" || http.CanonicalHeaderKey(key) == "Transfer-Encoding" {
+			continue
+		}
+		r.Header(key, values[0], values[1:]...)
+	}
+	return r
+}
+
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(body, encoding string) []byte {
+	if encoding == "base64" {
+		if data, err := base64.StdEncoding.DecodeString(body); err == nil {
+			return data
+		}
+	}
+	return []byte(body)
+}
@@ -0,0 +1,228 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func startUpstream(t *testing.T) *Server {
+	upstream := StartServer(WithName("upstream"), WithEndpoints(
+		NewServerEndpoint().
+			When(Request().GET("/items")).
+			RespondInSequence(
+				Response().Header("Content-Type", "application/json").BodyString(`["a"]`),
+				Response().Header("Content-Type", "application/json").BodyString(`["a","b"]`)),
+		NewServerEndpoint().
+			When(Request().POST("/items").BodyString("c")).
+			Respond(Response().StatusCode(http.StatusCreated).Header("Set-Token", "secret").BodyString("created c")),
+		NewServerEndpoint().
+			When(Request().POST("/items")).
+			Respond(Response().StatusCode(http.StatusCreated).BodyString("created")),
+		NewServerEndpoint().
+			When(Request().GET("/binary")).
+			Respond(Response().Body([]byte{0xff, 0x00, 0xfe})),
+		NewServerEndpoint().
+			When(Request().GET("/session")).
+			Respond(Response().Header("Set-Cookie", "session=secret").BodyString("session"))))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func sendRequest(t *testing.T, client *http.Client, method, url, body string, header http.Header) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	return res.StatusCode, string(MustReadAll(t, res.Body))
+}
+
+func TestCassette_RecordAndReplayClient(t *testing.T) {
+	upstream := startUpstream(t)
+	dir, err := ioutil.TempDir("", "cassette")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fixtures", "cassette.json")
+
+	// Record
+	cassette := NewCassette(
+		RedactHeaders("Set-Token"),
+		RedactQuery("token"),
+		RedactWith(func(interaction *Interaction) {
+			interaction.Response.Body = strings.Replace(interaction.Response.Body, "created", "CREATED", -1)
+		}))
+	client := NewClient(cassette.RecordingClientEndpoint(http.DefaultTransport)).HttpClient()
+	auth := http.Header{"Authorization": {"Bearer secret"}, "X-Tenant": {"acme"}}
+	for _, expected := range []string{`["a"]`, `["a","b"]`} {
+		status, body := sendRequest(t, client, "GET", upstream.BaseUrl()+"/items?token=secret&page=1", "", auth)
+		assert.Equal(t, http.StatusOK, status, "unexpected status while recording")
+		assert.Equal(t, expected, body, "unexpected body while recording")
+	}
+	status, body := sendRequest(t, client, "POST", upstream.BaseUrl()+"/items", "c", auth)
+	assert.Equal(t, http.StatusCreated, status, "unexpected status while recording")
+	assert.Equal(t, "created c", body, "expected response not to be redacted while recording")
+	sendRequest(t, client, "POST", upstream.BaseUrl()+"/items", "d", auth)
+	sendRequest(t, client, "GET", upstream.BaseUrl()+"/binary", "", nil)
+
+	interactions := cassette.Interactions()
+	require.Equal(t, 5, len(interactions), "unexpected number of recorded interactions")
+	assert.Equal(t, "GET", interactions[0].Request.Method, "unexpected recorded method")
+	assert.Equal(t, upstream.BaseUrl()+"/items?page=1&token="+Redacted, interactions[0].Request.URL, "unexpected recorded URL")
+	assert.Equal(t, Redacted, interactions[0].Request.Header.Get("Authorization"), "expected header to be redacted")
+	assert.Equal(t, `["a"]`, interactions[0].Response.Body, "unexpected recorded body")
+	assert.Equal(t, "c", interactions[2].Request.Body, "unexpected recorded request body")
+	assert.Equal(t, Redacted, interactions[2].Response.Header.Get("Set-Token"), "expected response header to be redacted")
+	assert.Equal(t, "CREATED c", interactions[2].Response.Body, "expected body to be redacted")
+	assert.Equal(t, "/wD+", interactions[4].Response.Body, "expected binary body to be base64 encoded")
+	assert.Equal(t, "base64", interactions[4].Response.BodyEncoding, "unexpected body encoding")
+
+	require.NoError(t, cassette.Save(path))
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret", "expected saved cassette not to contain secrets")
+
+	// Replay, matching by method and path
+	loaded, err := LoadCassette(path)
+	require.NoError(t, err)
+	assert.Equal(t, interactions, loaded.Interactions(), "unexpected loaded interactions")
+	client = NewClient(loaded.ClientEndpoints()...).HttpClient()
+	for _, expected := range []string{`["a"]`, `["a","b"]`, `["a","b"]`} {
+		status, body := sendRequest(t, client, "GET", "http://offline/items", "", nil)
+		assert.Equal(t, http.StatusOK, status, "unexpected replayed status")
+		assert.Equal(t, expected, body, "unexpected replayed body")
+	}
+	for _, expected := range []string{"CREATED c", "CREATED", "CREATED"} {
+		status, body := sendRequest(t, client, "POST", "http://offline/items", "any", nil)
+		assert.Equal(t, http.StatusCreated, status, "unexpected replayed status")
+		assert.Equal(t, expected, body, "unexpected replayed body")
+	}
+	status, body = sendRequest(t, client, "GET", "http://offline/binary", "", nil)
+	assert.Equal(t, http.StatusOK, status, "unexpected replayed status")
+	assert.Equal(t, string([]byte{0xff, 0x00, 0xfe}), body, "unexpected replayed binary body")
+	status, _ = sendRequest(t, client, "GET", "http://offline/unknown", "", nil)
+	assert.Equal(t, http.StatusNotImplemented, status, "unexpected status for a request which was not recorded")
+
+	// Replay, matching also by body and headers (redacted headers are not matched)
+	loaded, err = LoadCassette(path, MatchBody(), MatchHeaders("Authorization", "X-Tenant"))
+	require.NoError(t, err)
+	client = NewClient(loaded.ClientEndpoints()...).HttpClient()
+	tenant := http.Header{"Authorization": {"Bearer other"}, "X-Tenant": {"acme"}}
+	_, body = sendRequest(t, client, "POST", "http://offline/items", "d", tenant)
+	assert.Equal(t, "CREATED", body, "unexpected replayed body when matching by body")
+	_, body = sendRequest(t, client, "POST", "http://offline/items", "c", tenant)
+	assert.Equal(t, "CREATED c", body, "unexpected replayed body when matching by body")
+	status, _ = sendRequest(t, client, "POST", "http://offline/items", "c", http.Header{"X-Tenant": {"other"}})
+	assert.Equal(t, http.StatusNotImplemented, status, "unexpected status when matching by headers")
+}
+
+func TestCassette_ReplayRedactedQuery(t *testing.T) {
+	upstream := startUpstream(t)
+	dir, err := ioutil.TempDir("", "cassette")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	cassette := NewCassette(RedactQuery("api_key"))
+	client := NewClient(cassette.RecordingClientEndpoint(http.DefaultTransport)).HttpClient()
+	status, _ := sendRequest(t, client, "GET", upstream.BaseUrl()+"/items?api_key=secret&x=1", "", nil)
+	assert.Equal(t, http.StatusOK, status, "unexpected status while recording")
+	require.NoError(t, cassette.Save(path))
+
+	// redacted query parameters are not matched
+	loaded, err := LoadCassette(path, MatchQuery())
+	require.NoError(t, err)
+	client = NewClient(loaded.ClientEndpoints()...).HttpClient()
+	status, body := sendRequest(t, client, "GET", "http://offline/items?api_key=secret&x=1", "", nil)
+	assert.Equal(t, http.StatusOK, status, "unexpected replayed status")
+	assert.Equal(t, `["a"]`, body, "unexpected replayed body")
+	status, _ = sendRequest(t, client, "GET", "http://offline/items?api_key=other&x=1", "", nil)
+	assert.Equal(t, http.StatusOK, status, "unexpected replayed status with another redacted value")
+	status, _ = sendRequest(t, client, "GET", "http://offline/items?api_key=secret&x=2", "", nil)
+	assert.Equal(t, http.StatusNotImplemented, status, "unexpected status when matching by query")
+}
+
+func TestCassette_DefaultRedactedHeaders(t *testing.T) {
+	upstream := startUpstream(t)
+	header := http.Header{
+		"Authorization":       {"Bearer secret"},
+		"Proxy-Authorization": {"Basic secret"},
+		"Cookie":              {"session=secret"},
+	}
+
+	cassette := NewCassette()
+	sendRequest(t, NewClient(cassette.RecordingClientEndpoint(http.DefaultTransport)).HttpClient(), "GET", upstream.BaseUrl()+"/session", "", header)
+	interactions := cassette.Interactions()
+	require.Equal(t, 1, len(interactions), "unexpected number of recorded interactions")
+	for _, key := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+		assert.Equal(t, Redacted, interactions[0].Request.Header.Get(key), "expected %s header to be redacted by default", key)
+	}
+	assert.Equal(t, Redacted, interactions[0].Response.Header.Get("Set-Cookie"), "expected Set-Cookie header to be redacted by default")
+
+	cassette = NewCassette(UnredactHeaders("cookie", "Set-Cookie"))
+	sendRequest(t, NewClient(cassette.RecordingClientEndpoint(http.DefaultTransport)).HttpClient(), "GET", upstream.BaseUrl()+"/session", "", header)
+	interactions = cassette.Interactions()
+	require.Equal(t, 1, len(interactions), "unexpected number of recorded interactions")
+	assert.Equal(t, Redacted, interactions[0].Request.Header.Get("Authorization"), "expected Authorization header to be redacted by default")
+	assert.Equal(t, "session=secret", interactions[0].Request.Header.Get("Cookie"), "expected Cookie header not to be redacted")
+	assert.Equal(t, "session=secret", interactions[0].Response.Header.Get("Set-Cookie"), "expected Set-Cookie header not to be redacted")
+}
+
+func TestCassette_RecordAndReplayServer(t *testing.T) {
+	upstream := startUpstream(t)
+	upstreamURL, err := url.Parse(upstream.BaseUrl())
+	require.NoError(t, err)
+
+	// Record
+	cassette := NewCassette(MatchQuery())
+	proxy := StartServer(WithName("proxy"), WithEndpoints(cassette.RecordingServerEndpoint(upstreamURL)))
+	status, body := sendRequest(t, http.DefaultClient, "GET", proxy.BaseUrl()+"/items?page=1", "", nil)
+	assert.Equal(t, http.StatusOK, status, "unexpected status while recording")
+	assert.Equal(t, `["a"]`, body, "unexpected body while recording")
+	status, body = sendRequest(t, http.DefaultClient, "POST", proxy.BaseUrl()+"/items", "c", nil)
+	assert.Equal(t, http.StatusCreated, status, "unexpected status while recording")
+	assert.Equal(t, "created c", body, "unexpected body while recording")
+	proxy.Close()
+	assert.NoError(t, upstream.Verify(Request().GET("/items"), Once()))
+
+	interactions := cassette.Interactions()
+	require.Equal(t, 2, len(interactions), "unexpected number of recorded interactions")
+	assert.Equal(t, "/items?page=1", interactions[0].Request.URL, "unexpected recorded URL")
+	assert.Equal(t, "c", interactions[1].Request.Body, "unexpected recorded request body")
+	assert.Equal(t, "created c", interactions[1].Response.Body, "unexpected recorded response body")
+
+	// Replay
+	server := StartServer(WithName("replay"), WithEndpoints(cassette.ServerEndpoints()...))
+	defer server.Close()
+	status, body = sendRequest(t, http.DefaultClient, "GET", server.BaseUrl()+"/items?page=1", "", nil)
+	assert.Equal(t, http.StatusOK, status, "unexpected replayed status")
+	assert.Equal(t, `["a"]`, body, "unexpected replayed body")
+	status, _ = sendRequest(t, http.DefaultClient, "GET", server.BaseUrl()+"/items?page=2", "", nil)
+	assert.Equal(t, http.StatusNotFound, status, "unexpected status when matching by query")
+	status, body = sendRequest(t, http.DefaultClient, "POST", server.BaseUrl()+"/items", "c", nil)
+	assert.Equal(t, http.StatusCreated, status, "unexpected replayed status")
+	assert.Equal(t, "created c", body, "unexpected replayed body")
+}
+
+func TestLoadCassette_Errors(t *testing.T) {
+	_, err := LoadCassette(filepath.Join("no", "such", "cassette.json"))
+	assert.Error(t, err, "expected error when loading a missing cassette")
+
+	f, err := ioutil.TempFile("", "cassette")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("not json")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = LoadCassette(f.Name())
+	assert.Error(t, err, "expected error when loading an invalid cassette")
+}
@@ -1,10 +1,11 @@
 package mockhttp
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"strings"
+	"time"
 )
 
 // NewClient creates a new mock http client with a list of client endpoints it should handle
@@ -21,6 +22,7 @@ func NewClient(endpoints ...ClientEndpoint) *Client {
 	client := Client{}
 	client.endpoints = endpoints
 	client.requestRecorder = newRequestRecorder()
+	client.responseBodyLimit = DefaultResponseBodyLimit
 	client.httpClient = &http.Client{
 		Transport: &roundTripper{client: &client},
 	}
@@ -29,9 +31,21 @@ func NewClient(endpoints ...ClientEndpoint) *Client {
 
 // Client is a mock http client
 type Client struct {
-	httpClient      *http.Client
-	endpoints       []ClientEndpoint
-	requestRecorder *requestRecorder
+	httpClient        *http.Client
+	endpoints         []ClientEndpoint
+	requestRecorder   *requestRecorder
+	responseBodyLimit int
+}
+
+// WithResponseBodyLimit sets the maximum number of response body bytes recorded for each request (see
+// RecordedRequest.Response). The response body is returned in full, but bytes beyond the limit are not recorded. A
+// negative limit means no limit. Set it before sending requests.
+//
+// Set to DefaultResponseBodyLimit if not explicitly set. For example:
+//   client := NewClient(endpoints...).WithResponseBodyLimit(1024)
+func (c *Client) WithResponseBodyLimit(limit int) *Client {
+	c.responseBodyLimit = limit
+	return c
 }
 
 // HttpClient returns the actual http client, to be used by tests
@@ -40,12 +54,12 @@ func (c *Client) HttpClient() *http.Client {
 }
 
 // AcceptedRequests returns all requests which this client received and were handled by one of the defined endpoints
-func (c *Client) AcceptedRequests() []recordedRequest {
+func (c *Client) AcceptedRequests() []RecordedRequest {
 	return c.requestRecorder.AcceptedRequests()
 }
 
 // UnmatchedRequests returns all requests which this client received but did not match any of the defined endpoints
-func (c *Client) UnmatchedRequests() []recordedRequest {
+func (c *Client) UnmatchedRequests() []RecordedRequest {
 	return c.requestRecorder.UnmatchedRequests()
 }
 
@@ -54,28 +68,107 @@ func (c *Client) ClearHistory() {
 	c.requestRecorder.ClearHistory()
 }
 
+// Verify requests received by this client. Requires a request matcher to specify which requests to check and optionally
+// verify options (e.g. how many times, etc.). If it does not match the expectation, an error is returned, otherwise
+// returns nil.
+//
+// For example:
+//   // verify that the client got a GET request with path "/foo" exactly twice
+//   err := client.Verify(Request().GET("/foo"), Times(2))
+func (c *Client) Verify(matcher *requestMatcher, opts ...verifyOpt) error {
+	return newVerifier(matcher, opts...).verifyRequests(c.requestRecorder)
+}
+
+// VerifyInOrder verifies that this client received requests matching the given request matchers, in the given order.
+// Other requests may be received before, after and in between. If it does not match the expectation, an error is
+// returned (listing the actual requests timeline), otherwise returns nil.
+func (c *Client) VerifyInOrder(matchers ...*requestMatcher) error {
+	return verifyInOrder(c.requestRecorder, false, matchers...)
+}
+
+// VerifyInStrictOrder verifies that this client received requests matching the given request matchers, in the given
+// order, with no other requests in between. Other requests may be received before and after. If it does not match the
+// expectation, an error is returned (listing the actual requests timeline), otherwise returns nil.
+func (c *Client) VerifyInStrictOrder(matchers ...*requestMatcher) error {
+	return verifyInOrder(c.requestRecorder, true, matchers...)
+}
+
+// VerifyNoMoreInteractions verifies that all requests this client received (both accepted and unmatched) were
+// covered by previous successful verifications (Verify, VerifyInOrder or VerifyInStrictOrder). If there are requests
+// which were not verified, an error is returned listing them, otherwise returns nil.
+func (c *Client) VerifyNoMoreInteractions() error {
+	return verifyNoMoreInteractions(c.requestRecorder)
+}
+
+// VerifyExpectations verifies the expectations declared on the endpoints of this client (see the client endpoint's
+// Expect). Returns a single error listing all endpoints which did not meet their expectations, or nil if all
+// expectations are met.
+func (c *Client) VerifyExpectations() error {
+	endpoints := make([]expectationVerifier, len(c.endpoints))
+	for i, endpoint := range c.endpoints {
+		endpoints[i] = expectationVerifierOf(endpoint)
+	}
+	return verifyExpectations(endpoints)
+}
+
+// WaitFor waits for a request (matching the given matcher) to be received by this client, no matter if a matching
+// endpoint is defined. The provided context can be used e.g. for setting a timeout. Returns an error e.g. when waiting
+// has timed out.
+func (c *Client) WaitFor(ctx context.Context, matcher *requestMatcher) error {
+	return c.WaitForN(ctx, matcher, 1)
+}
+
+// WaitForN waits for n requests (matching the given matcher) to be received by this client, no matter if a matching
+// endpoint is defined. Only requests received after the call are counted. Returns an error e.g. when waiting has timed
+// out.
+func (c *Client) WaitForN(ctx context.Context, matcher *requestMatcher, n int) error {
+	_, err := waitFor(ctx, c.requestRecorder, matcher, n)
+	return err
+}
+
+// WaitForRequest waits for a request (matching the given matcher) to be received by this client, same as WaitFor, and
+// returns the received request.
+func (c *Client) WaitForRequest(ctx context.Context, matcher *requestMatcher) (RecordedRequest, error) {
+	requests, err := waitFor(ctx, c.requestRecorder, matcher, 1)
+	if err != nil {
+		return RecordedRequest{}, err
+	}
+	return requests[0], nil
+}
+
+// Requests returns a channel which streams the requests received by this client from now on, as they are recorded, no
+// matter if a matching endpoint is defined. If matchers are given, only requests matching all of them are streamed. The
+// channel is closed once the given context is done.
+func (c *Client) Requests(ctx context.Context, matchers ...*requestMatcher) <-chan RecordedRequest {
+	return c.requestRecorder.subscribe(ctx, matchers...)
+}
+
+// ExportHAR writes all requests received by this client (both accepted and unmatched), along with the recorded
+// responses, to the given writer as an HTTP Archive (HAR 1.2) JSON document.
+func (c *Client) ExportHAR(w io.Writer) error {
+	return exportHAR(w, c.requestRecorder.timeline())
+}
+
 type roundTripper struct {
 	client *Client
 }
 
 func (r *roundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	receivedAt := time.Now()
 	if r.client.endpoints != nil {
-		for _, endpoint := range r.client.endpoints {
-			if endpoint.Matches(request) {
-				r.client.requestRecorder.recordAcceptedRequest(request)
-				return endpoint.RoundTrip(request)
+		for i, endpoint := range r.client.endpoints {
+			if endpoint.Matches(request) && claim(endpoint, request) {
+				id := r.client.requestRecorder.recordAcceptedRequest(request, receivedAt, EndpointID(i+1), endpoint)
+				response, err := endpoint.RoundTrip(request)
+				return r.client.requestRecorder.recordResponse(id, response, err, r.client.responseBodyLimit)
 			}
 		}
 	}
-	r.client.requestRecorder.recordUnmatchedRequest(request)
-	return unmatchedRequestResponse(request), nil
+	id := r.client.requestRecorder.recordUnmatchedRequest(request, receivedAt)
+	return r.client.requestRecorder.recordResponse(id, unmatchedRequestResponse(request), nil, r.client.responseBodyLimit)
 }
 
 func unmatchedRequestResponse(request *http.Request) *http.Response {
-	return &http.Response{
-		StatusCode: http.StatusNotImplemented,
-		Body:       ioutil.NopCloser(strings.NewReader(fmt.Sprintf("Unmatched request: %s %s", request.Method, request.URL))),
-		Header:     http.Header{},
-		Request:    request,
-	}
+	body := []byte(fmt.Sprintf("Unmatched request: %s %s", request.Method, request.URL))
+	return newClientResponse(request, http.StatusNotImplemented, http.Header{}, body, nil)
 }
@@ -2,7 +2,8 @@ package mockhttp
 
 import (
 	"bytes"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"net/http"
 )
 
@@ -15,6 +16,9 @@ type ClientEndpoint interface {
 type clientEndpoint struct {
 	requestMatcher requestMatcher
 	roundTripFunc  RoundTripFunc
+	responses      responseSequence
+	limit          invocationLimit
+	expectations   []verifyOpt
 }
 
 // RoundTripFunc function for handling a request
@@ -24,7 +28,7 @@ type RoundTripFunc func(*http.Request) (*http.Response, error)
 func NewClientEndpoint() *clientEndpoint {
 	return &clientEndpoint{
 		requestMatcher: requestMatcher{},
-		roundTripFunc:  responseAsRoundTripFunc(Response()),
+		responses:      newResponseSequence(Response()),
 	}
 }
 
@@ -38,11 +42,40 @@ func (e *clientEndpoint) When(matcher *requestMatcher) *clientEndpoint {
 //
 // For more fine grain control, you can use HandleWith function instead.
 func (e *clientEndpoint) Respond(response *response) *clientEndpoint {
-	return e.HandleWith(responseAsRoundTripFunc(response))
+	return e.RespondInSequence(response)
+}
+
+// RespondInSequence defines the responses this client endpoint should return, one per request in the given order. Once
+// all responses are used, the last response repeats.
+func (e *clientEndpoint) RespondInSequence(responses ...*response) *clientEndpoint {
+	e.roundTripFunc = nil
+	e.responses.set(false, defaultResponseIfEmpty(responses)...)
+	return e
+}
+
+// RespondInCycle defines the responses this client endpoint should return, one per request in the given order. Once
+// all responses are used, the sequence starts over.
+func (e *clientEndpoint) RespondInCycle(responses ...*response) *clientEndpoint {
+	e.roundTripFunc = nil
+	e.responses.set(true, defaultResponseIfEmpty(responses)...)
+	return e
+}
+
+// RespondNth defines the response this client endpoint should return for the n-th request it handles (starting from
+// 1). It takes precedence over any other response, error or round trip function defined for this endpoint.
+func (e *clientEndpoint) RespondNth(n int, response *response) *clientEndpoint {
+	e.responses.setNth(n, response)
+	return e
 }
 
 // ReturnError defines an error to return when this client endpoint is triggered. To be used instead of Respond function to mock a
 // round trip error (e.g. connection error).
+//
+// Realistic transport errors can be created using ConnectionRefused, ConnectionReset, DialTimeout, DNSNotFound and
+// TLSUnknownAuthority. As with a real transport, the http client wraps the error in a *url.Error. For example:
+//   client := NewClient(NewClientEndpoint().ReturnError(ConnectionRefused()))
+//   _, err := client.HttpClient().Get("http://myhost/foo")
+//   errors.Is(err, syscall.ECONNREFUSED) // true
 func (e *clientEndpoint) ReturnError(err error) *clientEndpoint {
 	return e.HandleWith(func(request *http.Request) (*http.Response, error) {
 		return nil, err
@@ -55,28 +88,89 @@ func (e *clientEndpoint) ReturnError(err error) *clientEndpoint {
 // instead.
 func (e *clientEndpoint) HandleWith(roundTrip RoundTripFunc) *clientEndpoint {
 	e.roundTripFunc = roundTrip
+	e.responses.set(false)
+	return e
+}
+
+// Times limits the number of requests this client endpoint handles. Once it handled n requests, it no longer matches any
+// request, and the client falls through to the next matching endpoint (or to the unmatched request response if there is
+// none).
+func (e *clientEndpoint) Times(n int) *clientEndpoint {
+	e.limit.set(n)
+	return e
+}
+
+// Once limits this client endpoint to handle a single request. A shortcut for Times(1).
+func (e *clientEndpoint) Once() *clientEndpoint {
+	return e.Times(1)
+}
+
+// Expect declares how many requests this client endpoint is expected to handle, using verify options (e.g. Times,
+// AtLeast, AtMost, Never). Without options, the endpoint is expected to handle exactly one request. Expectations are
+// verified using the client's VerifyExpectations.
+func (e *clientEndpoint) Expect(opts ...verifyOpt) *clientEndpoint {
+	e.expectations = append([]verifyOpt{}, opts...)
 	return e
 }
 
 // RoundTrip is used internally, this is the http.RoundTripper implementation of the client endpoint.
 // This is part of the ClientEndpoint interface.
 func (e *clientEndpoint) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = withPathParams(request, e.requestMatcher.pathParams(request))
+	if r := e.responses.next(); r != nil {
+		return responseAsRoundTripFunc(r)(request)
+	}
 	return e.roundTripFunc(request)
 }
 
 // Matches is used internally to check if this client endpoint matches the given request and should handle it.
+// An endpoint which reached its invocation limit (see Times) does not match. Checking a match does not use the endpoint.
 // This is part of the ClientEndpoint interface.
 func (e *clientEndpoint) Matches(request *http.Request) bool {
-	return e.requestMatcher.matches(request)
+	return e.requestMatcher.matches(request) && e.limit.available()
+}
+
+// claim uses this client endpoint once, see Times. Returns false if the invocation limit is reached.
+func (e *clientEndpoint) claim(*http.Request) bool {
+	return e.limit.tryUse()
 }
 
 func responseAsRoundTripFunc(r *response) RoundTripFunc {
 	return func(request *http.Request) (*http.Response, error) {
-		return &http.Response{
-			StatusCode: r.statusCode,
-			Body:       ioutil.NopCloser(bytes.NewReader(r.body)),
-			Header:     r.header,
-			Request:    request,
-		}, nil
+		if r.fault != nil {
+			return nil, fmt.Errorf("fault %s is supported by server endpoints only", r.fault)
+		}
+		if err := r.wait(request.Context()); err != nil {
+			return nil, err
+		}
+		header, body, err := r.render(request)
+		if err != nil {
+			return nil, err
+		}
+		var bodyReader io.Reader
+		if r.bodyReadErr != nil {
+			bodyReader = io.MultiReader(bytes.NewReader(truncate(body, r.bodyReadErrAfter)), errorReader{r.bodyReadErr})
+		}
+		return newClientResponse(request, r.statusCode, header, body, bodyReader), nil
 	}
 }
+
+func (e *clientEndpoint) verifyExpectations() error {
+	if e.expectations == nil {
+		return nil
+	}
+	return verifyCount(e.responses.callCount(), e.expectations...)
+}
+
+func (e *clientEndpoint) String() string {
+	return fmt.Sprintf("Request(%s)", e.requestMatcher.String())
+}
+
+// errorReader is a reader which fails with the given error
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
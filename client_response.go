@@ -0,0 +1,97 @@
+package mockhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// newClientResponse creates a response of a mock client with the given status code, header and body, the same way the
+// net/http transport creates a response received for the given request:
+//   - The header is a copy, so changing it does not affect other responses
+//   - Content-Length is set, unless the header sets chunked transfer encoding, or the status code does not allow a body
+//   - No body for HEAD requests, and for status codes which do not allow a body
+//   - A gzip encoded body is decoded transparently, unless the request set the Accept-Encoding header
+//
+// If a body reader is given, it is used for reading the body (e.g. to simulate read errors), instead of the body.
+func newClientResponse(request *http.Request, statusCode int, header http.Header, body []byte, bodyReader io.Reader) *http.Response {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	res := &http.Response{
+		Status:        strings.TrimSpace(fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+	if strings.EqualFold(header.Get("Transfer-Encoding"), "chunked") {
+		header.Del("Transfer-Encoding")
+		header.Del("Content-Length")
+		res.TransferEncoding = []string{"chunked"}
+		res.ContentLength = -1
+	} else if contentLength, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		res.ContentLength = contentLength
+	} else if bodyAllowedForStatus(statusCode) {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	if request.Method == http.MethodHead || !bodyAllowedForStatus(statusCode) {
+		res.Body = http.NoBody
+		if !bodyAllowedForStatus(statusCode) {
+			res.ContentLength = 0
+		}
+		return res
+	}
+	if bodyReader == nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	contentEncoding := strings.TrimSpace(header.Get("Content-Encoding"))
+	if strings.EqualFold(contentEncoding, "gzip") && request.Header.Get("Accept-Encoding") == "" && request.Header.Get("Range") == "" {
+		// the transport requested a gzip encoded response by itself, so it decodes it
+		bodyReader = &gzipReader{body: bodyReader}
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Uncompressed = true
+	}
+	res.Body = ioutil.NopCloser(bodyReader)
+	return res
+}
+
+// bodyAllowedForStatus reports whether a response with the given status code may have a body (see RFC 7230, section 3.3)
+func bodyAllowedForStatus(statusCode int) bool {
+	switch {
+	case statusCode >= 100 && statusCode <= 199:
+		return false
+	case statusCode == http.StatusNoContent, statusCode == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// gzipReader decodes a gzip encoded body, lazily on the first read (so an invalid body fails when it is read)
+type gzipReader struct {
+	body io.Reader
+	zr   *gzip.Reader
+	err  error
+}
+
+func (r *gzipReader) Read(p []byte) (int, error) {
+	if r.zr == nil && r.err == nil {
+		r.zr, r.err = gzip.NewReader(r.body)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.zr.Read(p)
+}
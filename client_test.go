@@ -1,12 +1,26 @@
 package mockhttp_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/jfrog/go-mockhttp"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestClient(t *testing.T) {
@@ -30,6 +44,70 @@ func TestClient(t *testing.T) {
 			name:     "MatchRequests",
 			testFunc: subtest_MatchRequests,
 		},
+		{
+			name:     "PathTemplate",
+			testFunc: subtest_PathTemplate,
+		},
+		{
+			name:     "RespondInSequence",
+			testFunc: subtest_RespondInSequence,
+		},
+		{
+			name:     "EndpointTimes",
+			testFunc: subtest_EndpointTimes,
+		},
+		{
+			name:     "Verify",
+			testFunc: subtest_Verify,
+		},
+		{
+			name:     "VerifyExpectations",
+			testFunc: subtest_VerifyExpectations,
+		},
+		{
+			name:     "WaitFor",
+			testFunc: subtest_WaitFor,
+		},
+		{
+			name:     "Requests",
+			testFunc: subtest_Requests,
+		},
+		{
+			name:     "RecordedRequestDetails",
+			testFunc: subtest_RecordedRequestDetails,
+		},
+		{
+			name:     "RecordedResponse",
+			testFunc: subtest_RecordedResponse,
+		},
+		{
+			name:     "ExportHAR",
+			testFunc: subtest_ExportHAR,
+		},
+		{
+			name:     "Fault",
+			testFunc: subtest_Fault,
+		},
+		{
+			name:     "TransportErrors",
+			testFunc: subtest_TransportErrors,
+		},
+		{
+			name:     "BodyReadError",
+			testFunc: subtest_BodyReadError,
+		},
+		{
+			name:     "Delay",
+			testFunc: subtest_Delay,
+		},
+		{
+			name:     "VerifyNoMoreInteractions",
+			testFunc: subtest_VerifyNoMoreInteractions,
+		},
+		{
+			name:     "RealisticResponse",
+			testFunc: subtest_RealisticResponse,
+		},
 		{
 			name:     "EmptyClient",
 			testFunc: subtest_EmptyClient,
@@ -114,8 +192,557 @@ func subtest_MatchRequests(t *testing.T) {
 
 	assertClientRecordedRequestCount(t, client, 3, 1)
 
+	assert.Error(t, client.VerifyNoMoreInteractions(), "expected unverified requests")
+
 	client.ClearHistory()
 	assertClientRecordedRequestCount(t, client, 0, 0)
+	assert.NoError(t, client.VerifyNoMoreInteractions(), "no unverified requests were expected after history cleanup")
+}
+
+func subtest_PathTemplate(t *testing.T) {
+	client := mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().Method("GET").PathTemplate("/users/{user}")).
+			Respond(mockhttp.Response().BodyString("hello {user}").ExpandPathParams()),
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().Method("DELETE").PathTemplate("/users/{user}")).
+			HandleWith(func(request *http.Request) (*http.Response, error) {
+				return nil, fmt.Errorf("cannot delete %s", mockhttp.PathParam(request, "user"))
+			}),
+	)
+	res, err := client.HttpClient().Get("http://myhost/users/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello foo", string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+
+	req, err := http.NewRequest("DELETE", "http://myhost/users/bar", nil)
+	assert.NoError(t, err)
+	_, err = client.HttpClient().Do(req)
+	assert.EqualError(t, err, "Delete \"http://myhost/users/bar\": cannot delete bar", "expected an error with a specific message")
+}
+
+func subtest_RespondInSequence(t *testing.T) {
+	client := mockhttp.NewClient(mockhttp.NewClientEndpoint().
+		ReturnError(fmt.Errorf("connection refused")).
+		RespondNth(3, mockhttp.Response().StatusCode(http.StatusAccepted)).
+		RespondNth(4, mockhttp.Response().BodyString("done")))
+	for i := 0; i < 2; i++ {
+		_, err := client.HttpClient().Get("http://myhost/foo")
+		assert.Error(t, err, "expected an error for request #%d", i+1)
+	}
+	res, err := client.HttpClient().Get("http://myhost/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode, "unexpected response status code")
+	res, err = client.HttpClient().Get("http://myhost/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "done", string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+	_, err = client.HttpClient().Get("http://myhost/foo")
+	assert.Error(t, err, "expected an error after the overridden responses")
+
+	client = mockhttp.NewClient(mockhttp.NewClientEndpoint().RespondInSequence(
+		mockhttp.Response().StatusCode(http.StatusTooManyRequests),
+		mockhttp.Response().StatusCode(http.StatusOK)))
+	for _, expected := range []int{http.StatusTooManyRequests, http.StatusOK, http.StatusOK} {
+		res, err := client.HttpClient().Get("http://myhost/foo")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res.StatusCode, "unexpected response status code")
+	}
+}
+
+func subtest_EndpointTimes(t *testing.T) {
+	client := mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().Times(2).ReturnError(fmt.Errorf("connection reset")),
+		mockhttp.NewClientEndpoint().Once().Respond(mockhttp.Response().BodyString("done")),
+	)
+	for i := 0; i < 2; i++ {
+		_, err := client.HttpClient().Get("http://myhost/foo")
+		assert.Errorf(t, err, "expected an error for request #%d", i+1)
+	}
+	res, err := client.HttpClient().Get("http://myhost/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "done", string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+	res, err = client.HttpClient().Get("http://myhost/foo")
+	assert.NoError(t, err)
+	assertNotImplementedResponse(t, res)
+	assertClientRecordedRequestCount(t, client, 3, 1)
+}
+
+func subtest_Verify(t *testing.T) {
+	client := mockhttp.NewClient(mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/session")))
+	assert.NoError(t, client.Verify(mockhttp.Request().Path("/session"), mockhttp.Never()))
+	assertErrorMatches(t, client.Verify(mockhttp.Request().Path("/session")), regexp.MustCompile("request was called unexpected number of times. expected: 1, actual: 0.*"))
+
+	_, err := client.HttpClient().Post("http://myhost/session", "text/plain", strings.NewReader("hello"))
+	assert.NoError(t, err)
+	_, err = client.HttpClient().Get("http://myhost/data")
+	assert.NoError(t, err)
+	req, err := http.NewRequest("DELETE", "http://myhost/session", nil)
+	assert.NoError(t, err)
+	_, err = client.HttpClient().Do(req)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Verify(mockhttp.Request().Path("/session"), mockhttp.Times(2)))
+	assert.NoError(t, client.Verify(mockhttp.Request().POST("/session").BodyString("hello")))
+	assert.NoError(t, client.Verify(mockhttp.Request().GET("/data"), mockhttp.AtLeast(1)))
+	assertErrorMatches(t, client.Verify(mockhttp.Request().GET("/data"), mockhttp.AtMost(0)), regexp.MustCompile("expected at most: 0, actual: 1"))
+	assert.NoError(t, client.VerifyInOrder(mockhttp.Request().POST("/session"), mockhttp.Request().DELETE("/session")))
+	assert.NoError(t, client.VerifyInStrictOrder(mockhttp.Request().GET("/data"), mockhttp.Request().DELETE("/session")))
+	assertErrorMatches(t, client.VerifyInStrictOrder(mockhttp.Request().POST("/session"), mockhttp.Request().DELETE("/session")), regexp.MustCompile("^requests were not received in strict order"))
+	assert.NoError(t, client.VerifyNoMoreInteractions())
+}
+
+func subtest_VerifyNoMoreInteractions(t *testing.T) {
+	client := mockhttp.NewClient(mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/foo")))
+	_, err := client.HttpClient().Get("http://myhost/foo")
+	assert.NoError(t, err)
+	_, err = client.HttpClient().Get("http://myhost/bar")
+	assert.NoError(t, err)
+	assertErrorMatches(t, client.VerifyNoMoreInteractions(), regexp.MustCompile(`^found 2 unverified requests:\n   1: GET /foo \(accepted\)\n   2: GET /bar \(unmatched\)\n$`))
+
+	// a failed verification does not mark requests as verified
+	assert.Error(t, client.Verify(mockhttp.Request().Path("/foo"), mockhttp.Times(2)))
+	assert.NoError(t, client.Verify(mockhttp.Request().Path("/foo")))
+	assertErrorMatches(t, client.VerifyNoMoreInteractions(), regexp.MustCompile(`^found 1 unverified requests:\n   1: GET /bar \(unmatched\)\n$`))
+
+	assert.NoError(t, client.VerifyInOrder(mockhttp.Request().Path("/bar")))
+	assert.NoError(t, client.VerifyNoMoreInteractions())
+}
+
+func subtest_VerifyExpectations(t *testing.T) {
+	client := mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().GET("/foo")).Expect(mockhttp.Times(2)),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().GET("/bar")).Expect(mockhttp.Never()),
+	)
+	assertErrorMatches(t, client.VerifyExpectations(), regexp.MustCompile(`^1 endpoints did not meet their expectations:\n   1: Request\(Method\(GET\),Path\(/foo\)\) - .*expected: 2, actual: 0$`))
+	for i := 0; i < 2; i++ {
+		_, err := client.HttpClient().Get("http://myhost/foo")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, client.VerifyExpectations())
+	_, err := client.HttpClient().Get("http://myhost/bar")
+	assert.NoError(t, err)
+	assertErrorMatches(t, client.VerifyExpectations(), regexp.MustCompile(`^1 endpoints did not meet their expectations:\n   2: Request\(Method\(GET\),Path\(/bar\)\) - .*expected: 0, actual: 1$`))
+}
+
+func subtest_WaitFor(t *testing.T) {
+	client := mockhttp.NewClient(mockhttp.NewClientEndpoint().When(mockhttp.Request().GET("/foo")))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = client.HttpClient().Get("http://myhost/foo")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, client.WaitFor(ctx, mockhttp.Request().GET("/foo")))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, client.WaitFor(ctx, mockhttp.Request().GET("/foo")), "expected waiting to time out")
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			time.Sleep(20 * time.Millisecond)
+			_, _ = client.HttpClient().Get(fmt.Sprintf("http://myhost/foo?i=%d", i))
+		}
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, client.WaitForN(ctx, mockhttp.Request().GET("/foo"), 2))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = client.HttpClient().Get("http://myhost/foo?id=42")
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	request, err := client.WaitForRequest(ctx, mockhttp.Request().GET("/foo"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "42", request.Query.Get("id"), "unexpected query of waited request")
+	}
+}
+
+func subtest_Requests(t *testing.T) {
+	client := mockhttp.NewClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := client.Requests(ctx)
+	go func() {
+		_, _ = client.HttpClient().Get("http://myhost/foo")
+		_, _ = client.HttpClient().Post("http://myhost/bar", "text/plain", strings.NewReader("hello"))
+	}()
+
+	for _, expected := range []string{"GET /foo", "POST /bar"} {
+		select {
+		case request := <-requests:
+			assert.Equal(t, expected, request.Method+" "+request.Path, "unexpected streamed request")
+		case <-time.After(time.Second):
+			assert.Fail(t, "timed out waiting for request", expected)
+		}
+	}
+	cancel()
+	_, open := <-requests
+	assert.False(t, open, "expected channel to be closed after context is done")
+}
+
+func subtest_RecordedRequestDetails(t *testing.T) {
+	client := mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().POST("/foo")),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().GET("/foo").BodyFunc(func(body []byte) bool {
+			// slow matching is part of the request handling duration
+			time.Sleep(50 * time.Millisecond)
+			return true
+		})))
+	_, err := client.HttpClient().Get("http://myhost:8080/foo")
+	assert.NoError(t, err)
+	_, err = client.HttpClient().Get("http://otherhost/bar")
+	assert.NoError(t, err)
+
+	accepted := client.AcceptedRequests()
+	if assert.Equal(t, 1, len(accepted), "unexpected number of accepted requests") {
+		assert.Equal(t, "myhost:8080", accepted[0].Host, "unexpected host")
+		assert.Equal(t, "HTTP/1.1", accepted[0].Proto, "unexpected protocol")
+		assert.False(t, accepted[0].ReceivedAt.IsZero(), "expected receive time to be set")
+		assert.True(t, accepted[0].Duration >= 50*time.Millisecond, "expected receive time to be set before matching, duration: %v", accepted[0].Duration)
+		assert.Equal(t, mockhttp.EndpointID(2), accepted[0].EndpointID, "unexpected endpoint ID")
+	}
+	unmatched := client.UnmatchedRequests()
+	if assert.Equal(t, 1, len(unmatched), "unexpected number of unmatched requests") {
+		assert.Equal(t, "otherhost", unmatched[0].Host, "unexpected host")
+		assert.Zero(t, unmatched[0].EndpointID, "unexpected endpoint ID for unmatched request")
+	}
+}
+
+func subtest_RecordedResponse(t *testing.T) {
+	client := mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().GET("/foo")).
+			Respond(mockhttp.Response().StatusCode(http.StatusCreated).Header("X-Foo", "foo").BodyString("hello")),
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().GET("/error")).
+			ReturnError(fmt.Errorf("dummy error")))
+
+	res, err := client.HttpClient().Get("http://myhost/foo")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello", string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+		_ = res.Body.Close()
+	}
+	_, err = client.HttpClient().Get("http://myhost/error")
+	assert.Error(t, err)
+
+	accepted := client.AcceptedRequests()
+	if assert.Equal(t, 2, len(accepted), "unexpected number of accepted requests") {
+		response := accepted[0].Response
+		if assert.NotNil(t, response, "expected response to be recorded") {
+			assert.Equal(t, http.StatusCreated, response.StatusCode, "unexpected recorded status code")
+			assert.Equal(t, "foo", response.Header.Get("X-Foo"), "unexpected recorded header")
+			assert.Equal(t, "hello", response.BodyAsString(), "unexpected recorded body")
+			assert.NoError(t, response.Error, "unexpected recorded error")
+		}
+		if assert.NotNil(t, accepted[1].Response, "expected error to be recorded") {
+			assert.EqualError(t, accepted[1].Response.Error, "dummy error", "unexpected recorded error")
+		}
+	}
+
+	// response body limit, and responses without a body
+	client = mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().GET("/foo")).Respond(mockhttp.Response().BodyString("hello")),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().GET("/no-content")).Respond(mockhttp.Response().StatusCode(http.StatusNoContent))).
+		WithResponseBodyLimit(3)
+	res, err = client.HttpClient().Get("http://myhost/foo")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello", string(mockhttp.MustReadAll(t, res.Body)), "expected full response body")
+		_ = res.Body.Close()
+	}
+	res, err = client.HttpClient().Get("http://myhost/no-content")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.NoBody, res.Body, "expected no body")
+	}
+	accepted = client.AcceptedRequests()
+	if assert.Equal(t, 2, len(accepted), "unexpected number of accepted requests") {
+		if assert.NotNil(t, accepted[0].Response, "expected response to be recorded") {
+			assert.Equal(t, "hel", accepted[0].Response.BodyAsString(), "unexpected recorded body")
+			assert.True(t, accepted[0].Response.BodyTruncated, "expected recorded body to be truncated")
+			assert.Equal(t, int64(5), accepted[0].Response.BodySize, "unexpected recorded body size")
+		}
+		if assert.NotNil(t, accepted[1].Response, "expected response to be recorded") {
+			assert.Equal(t, http.StatusNoContent, accepted[1].Response.StatusCode, "unexpected recorded status code")
+		}
+	}
+}
+
+func subtest_ExportHAR(t *testing.T) {
+	client := mockhttp.NewClient(mockhttp.NewClientEndpoint().When(mockhttp.Request().GET("/error")).ReturnError(fmt.Errorf("dummy error")))
+	_, err := client.HttpClient().Get("https://myhost/error")
+	assert.Error(t, err)
+	_, err = client.HttpClient().Get("https://myhost/other")
+	assert.NoError(t, err)
+
+	b := strings.Builder{}
+	if assert.NoError(t, client.ExportHAR(&b)) {
+		har := b.String()
+		assert.Contains(t, har, `"url": "https://myhost/error"`, "expected 1st request in HAR")
+		assert.Contains(t, har, `"_error": "dummy error"`, "expected error in HAR")
+		assert.Contains(t, har, `"url": "https://myhost/other"`, "expected 2nd request in HAR")
+		assert.Contains(t, har, `"status": 501`, "expected response of unmatched request in HAR")
+	}
+}
+
+func subtest_Fault(t *testing.T) {
+	client := mockhttp.NewClient(mockhttp.NewClientEndpoint().Respond(mockhttp.Response().Fault(mockhttp.ResetConnection())))
+	_, err := client.HttpClient().Get("http://myhost/foo")
+	assertErrorMatches(t, err, regexp.MustCompile("fault ResetConnection is supported by server endpoints only$"))
+}
+
+func subtest_TransportErrors(t *testing.T) {
+	// the error of a real client, for a server with a self-signed certificate
+	server := mockhttp.StartServer(mockhttp.WithTls(&tls.Config{}))
+	// the certificate of the test server is valid for example.com
+	realClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{ServerName: "example.com"}}}
+	_, realTLSErr := realClient.Get(server.BaseUrl())
+	server.Close()
+	var realTLSURLErr *url.Error
+	if !assert.True(t, errors.As(realTLSErr, &realTLSURLErr), "expected real TLS error to be wrapped in *url.Error") {
+		return
+	}
+	// the error of a real client, which times out connecting to the server
+	dialer := &net.Dialer{Deadline: time.Now().Add(-time.Second)}
+	_, realDialErr := (&http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}).Get("http://127.0.0.1:1")
+
+	tests := []struct {
+		name        string
+		err         error
+		expectedMsg string
+		timeout     bool
+		assertErr   func(t *testing.T, err error)
+	}{
+		{
+			name:        "ConnectionRefused",
+			err:         mockhttp.ConnectionRefused(),
+			expectedMsg: "dial tcp: connect: connection refused",
+			assertErr: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, syscall.ECONNREFUSED), "expected ECONNREFUSED")
+			},
+		},
+		{
+			name:        "ConnectionReset",
+			err:         mockhttp.ConnectionReset(),
+			expectedMsg: "read tcp: read: connection reset by peer",
+			assertErr: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, syscall.ECONNRESET), "expected ECONNRESET")
+			},
+		},
+		{
+			name:        "DialTimeout",
+			err:         mockhttp.DialTimeout(),
+			expectedMsg: "dial tcp: i/o timeout",
+			timeout:     true,
+			assertErr: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected context deadline exceeded")
+				assert.Equal(t, errors.Is(realDialErr, context.DeadlineExceeded), errors.Is(err, context.DeadlineExceeded), "expected context deadline exceeded like a real dial timeout")
+				assert.Equal(t, errors.Is(realDialErr, os.ErrDeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded), "expected os deadline exceeded like a real dial timeout")
+			},
+		},
+		{
+			name:        "DNSNotFound",
+			err:         mockhttp.DNSNotFound("myhost"),
+			expectedMsg: "dial tcp: lookup myhost: no such host",
+			assertErr: func(t *testing.T, err error) {
+				var dnsErr *net.DNSError
+				if assert.True(t, errors.As(err, &dnsErr), "expected DNS error") {
+					assert.True(t, dnsErr.IsNotFound, "expected DNS error of host not found")
+					assert.Equal(t, "myhost", dnsErr.Name, "unexpected host of DNS error")
+				}
+			},
+		},
+		{
+			name:        "TLSUnknownAuthority",
+			err:         mockhttp.TLSUnknownAuthority(),
+			expectedMsg: realTLSURLErr.Err.Error(),
+			assertErr: func(t *testing.T, err error) {
+				unknownAuthorityErr := x509.UnknownAuthorityError{}
+				if assert.True(t, errors.As(err, &unknownAuthorityErr), "expected unknown authority error") {
+					assert.NotNil(t, unknownAuthorityErr.Cert, "expected the certificate of the remote host")
+				}
+				assert.Equal(t, fmt.Sprintf("%T", realTLSURLErr.Err), fmt.Sprintf("%T", errors.Unwrap(err)), "expected error to be wrapped like a real TLS error")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mockhttp.NewClient(mockhttp.NewClientEndpoint().ReturnError(tt.err))
+			_, err := client.HttpClient().Get("http://myhost/foo")
+			var urlErr *url.Error
+			if assert.True(t, errors.As(err, &urlErr), "expected error to be wrapped in *url.Error") {
+				assert.Equal(t, "Get", urlErr.Op, "unexpected operation of *url.Error")
+				assert.Equal(t, "http://myhost/foo", urlErr.URL, "unexpected URL of *url.Error")
+				assert.Equal(t, tt.expectedMsg, urlErr.Err.Error(), "unexpected error message")
+				assert.Equal(t, tt.timeout, urlErr.Timeout(), "unexpected timeout of *url.Error")
+			}
+			if !errors.As(tt.err, &x509.UnknownAuthorityError{}) {
+				var opErr *net.OpError
+				assert.True(t, errors.As(err, &opErr), "expected *net.OpError")
+			}
+			tt.assertErr(t, err)
+		})
+	}
+}
+
+func subtest_BodyReadError(t *testing.T) {
+	client := mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().GET("/eof")).
+			Respond(mockhttp.Response().BodyString("hello world").BodyReadError(4, nil)),
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().GET("/reset")).
+			Respond(mockhttp.Response().BodyString("hello world").BodyReadError(6, mockhttp.ConnectionReset())))
+
+	res, err := client.HttpClient().Get("http://myhost/eof")
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(res.Body)
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "unexpected error reading body")
+		assert.Equal(t, "hell", string(body), "unexpected body read before the error")
+	}
+	res, err = client.HttpClient().Get("http://myhost/reset")
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(res.Body)
+		assert.True(t, errors.Is(err, syscall.ECONNRESET), "unexpected error reading body: %v", err)
+		assert.Equal(t, "hello ", string(body), "unexpected body read before the error")
+	}
+}
+
+func subtest_Delay(t *testing.T) {
+	client := mockhttp.NewClient(
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().GET("/short")).
+			Respond(mockhttp.Response().BodyString("done").Delay(50*time.Millisecond)),
+		mockhttp.NewClientEndpoint().
+			When(mockhttp.Request().GET("/long")).
+			Respond(mockhttp.Response().Delay(time.Minute)))
+
+	start := time.Now()
+	res, err := client.HttpClient().Get("http://myhost/short")
+	if assert.NoError(t, err) {
+		assert.True(t, time.Since(start) >= 50*time.Millisecond, "expected response to be delayed")
+		assert.Equal(t, "done", string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+	}
+
+	// request deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://myhost/long", nil)
+	assert.NoError(t, err)
+	start = time.Now()
+	_, err = client.HttpClient().Do(req)
+	assert.True(t, time.Since(start) < time.Second, "expected delay to be aborted when the request deadline passes")
+	var urlErr *url.Error
+	if assert.True(t, errors.As(err, &urlErr), "expected error to be wrapped in *url.Error, got: %v", err) {
+		assert.True(t, urlErr.Timeout(), "expected timeout error")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded error, got: %v", err)
+	}
+
+	// client timeout
+	httpClient := client.HttpClient()
+	httpClient.Timeout = 50 * time.Millisecond
+	defer func() { httpClient.Timeout = 0 }()
+	start = time.Now()
+	_, err = httpClient.Get("http://myhost/long")
+	assert.True(t, time.Since(start) < time.Second, "expected delay to be aborted when the client timeout passes")
+	if assert.True(t, errors.As(err, &urlErr), "expected error to be wrapped in *url.Error, got: %v", err) {
+		assert.True(t, urlErr.Timeout(), "expected timeout error")
+	}
+}
+
+func subtest_RealisticResponse(t *testing.T) {
+	gzipped := bytes.Buffer{}
+	zw := gzip.NewWriter(&gzipped)
+	_, _ = zw.Write([]byte("hello gzip"))
+	_ = zw.Close()
+
+	plain := mockhttp.Response().StatusCode(201).BodyString("created")
+	empty := mockhttp.Response()
+	noContent := mockhttp.Response().StatusCode(204)
+	chunked := mockhttp.Response().Header("Transfer-Encoding", "chunked").BodyString("chunked body")
+	gzipEncoded := mockhttp.Response().Header("Content-Encoding", "gzip").Body(gzipped.Bytes())
+	gzipUpperCase := mockhttp.Response().Header("Content-Encoding", "GZIP").Body(gzipped.Bytes())
+	serverEndpoints := []mockhttp.ServerEndpoint{
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().Path("/plain")).Respond(plain),
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().Path("/empty")).Respond(empty),
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().Path("/no-content")).Respond(noContent),
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().Path("/chunked")).Respond(chunked),
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().Path("/gzip")).Respond(gzipEncoded),
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().Path("/gzip-upper-case")).Respond(gzipUpperCase),
+	}
+	clientEndpoints := []mockhttp.ClientEndpoint{
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/plain")).Respond(plain),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/empty")).Respond(empty),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/no-content")).Respond(noContent),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/chunked")).Respond(chunked),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/gzip")).Respond(gzipEncoded),
+		mockhttp.NewClientEndpoint().When(mockhttp.Request().Path("/gzip-upper-case")).Respond(gzipUpperCase),
+	}
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(serverEndpoints...))
+	defer server.Close()
+	client := mockhttp.NewClient(clientEndpoints...)
+
+	tests := []struct {
+		method         string
+		path           string
+		acceptEncoding string
+	}{
+		{"GET", "/plain", ""},
+		{"HEAD", "/plain", ""},
+		{"GET", "/empty", ""},
+		{"GET", "/no-content", ""},
+		{"GET", "/chunked", ""},
+		{"GET", "/gzip", ""},
+		{"GET", "/gzip", "gzip"},
+		{"GET", "/gzip-upper-case", ""},
+	}
+	for _, test := range tests {
+		t.Run(strings.TrimSpace(fmt.Sprintf("%s %s %s", test.method, test.path, test.acceptEncoding)), func(t *testing.T) {
+			expected := doRequest(t, &http.Client{Transport: &http.Transport{}}, test.method, server.BuildUrl(test.path), test.acceptEncoding)
+			actual := doRequest(t, client.HttpClient(), test.method, "http://myhost"+test.path, test.acceptEncoding)
+			if expected == nil || actual == nil {
+				return
+			}
+			assert.Equal(t, expected.Status, actual.Status, "unexpected status")
+			assert.Equal(t, expected.Proto, actual.Proto, "unexpected proto")
+			assert.Equal(t, expected.ProtoMajor, actual.ProtoMajor, "unexpected proto major")
+			assert.Equal(t, expected.ProtoMinor, actual.ProtoMinor, "unexpected proto minor")
+			assert.Equal(t, expected.ContentLength, actual.ContentLength, "unexpected content length")
+			assert.Equal(t, expected.TransferEncoding, actual.TransferEncoding, "unexpected transfer encoding")
+			assert.Equal(t, expected.Uncompressed, actual.Uncompressed, "unexpected uncompressed")
+			for _, name := range []string{"Content-Length", "Content-Encoding", "Transfer-Encoding"} {
+				assert.Equal(t, expected.Header.Values(name), actual.Header.Values(name), "unexpected %s header", name)
+			}
+			assert.Equal(t, mockhttp.MustReadAll(t, expected.Body), mockhttp.MustReadAll(t, actual.Body), "unexpected body")
+		})
+	}
+
+	// changing the header of a response does not affect other responses
+	res, err := client.HttpClient().Get("http://myhost/plain")
+	if assert.NoError(t, err) {
+		res.Header.Set("Content-Length", "0")
+		res.Header.Set("X-Foo", "bar")
+	}
+	res, err = client.HttpClient().Get("http://myhost/plain")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "7", res.Header.Get("Content-Length"), "unexpected Content-Length header")
+		assert.Empty(t, res.Header.Get("X-Foo"), "unexpected X-Foo header")
+	}
+}
+
+func doRequest(t *testing.T, client *http.Client, method, url, acceptEncoding string) *http.Response {
+	req, err := http.NewRequest(method, url, nil)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	res, err := client.Do(req)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	return res
 }
 
 func subtest_EmptyClient(t *testing.T) {
@@ -136,7 +763,12 @@ func subtest_TransportError(t *testing.T) {
 func assertNotImplementedResponse(t *testing.T, res *http.Response) {
 	req := res.Request
 	assert.Equal(t, http.StatusNotImplemented, res.StatusCode, "unexpected response status code")
-	assert.Equal(t, fmt.Sprintf("Unmatched request: %s %s", req.Method, req.URL), string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+	expectedBody := fmt.Sprintf("Unmatched request: %s %s", req.Method, req.URL)
+	if req.Method == http.MethodHead {
+		// responses to HEAD requests have no body
+		expectedBody = ""
+	}
+	assert.Equal(t, expectedBody, string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
 }
 
 func assertClientRecordedRequestCount(t *testing.T, c *mockhttp.Client, expectedAccepted int, expectedUnmatched int) {
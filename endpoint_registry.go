@@ -0,0 +1,91 @@
+package mockhttp
+
+import (
+	"sync"
+)
+
+// EndpointID identifies an endpoint added to a mock http server, to be used e.g. for removing or replacing it. Endpoints
+// set using WithEndpoints are identified by their 1-based position. Also identifies the endpoint which handled a
+// recorded request (see RecordedRequest.EndpointID).
+type EndpointID uint64
+
+type registeredEndpoint struct {
+	id       EndpointID
+	endpoint ServerEndpoint
+}
+
+// endpointRegistry holds the endpoints of a mock http server, in the order they are matched. Safe for concurrent use.
+type endpointRegistry struct {
+	mtx       sync.RWMutex
+	endpoints []registeredEndpoint
+	lastID    EndpointID
+}
+
+func newEndpointRegistry() *endpointRegistry {
+	return &endpointRegistry{
+		endpoints: []registeredEndpoint{},
+	}
+}
+
+func (r *endpointRegistry) add(endpoint ServerEndpoint) EndpointID {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.lastID++
+	r.endpoints = append(r.endpoints, registeredEndpoint{id: r.lastID, endpoint: endpoint})
+	return r.lastID
+}
+
+func (r *endpointRegistry) remove(id EndpointID) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for i, registered := range r.endpoints {
+		if registered.id == id {
+			endpoints := make([]registeredEndpoint, 0, len(r.endpoints)-1)
+			endpoints = append(endpoints, r.endpoints[:i]...)
+			r.endpoints = append(endpoints, r.endpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *endpointRegistry) replace(id EndpointID, endpoint ServerEndpoint) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for i, registered := range r.endpoints {
+		if registered.id == id {
+			endpoints := make([]registeredEndpoint, len(r.endpoints))
+			copy(endpoints, r.endpoints)
+			endpoints[i].endpoint = endpoint
+			r.endpoints = endpoints
+			return true
+		}
+	}
+	return false
+}
+
+func (r *endpointRegistry) clear() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.endpoints = []registeredEndpoint{}
+}
+
+// registered returns a snapshot of all endpoints with their IDs, in the order they are matched
+func (r *endpointRegistry) registered() []registeredEndpoint {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	res := make([]registeredEndpoint, len(r.endpoints))
+	copy(res, r.endpoints)
+	return res
+}
+
+// all returns a snapshot of all endpoints, in the order they are matched
+func (r *endpointRegistry) all() []ServerEndpoint {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	res := make([]ServerEndpoint, len(r.endpoints))
+	for i, registered := range r.endpoints {
+		res[i] = registered.endpoint
+	}
+	return res
+}
@@ -0,0 +1,34 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEndpointRegistry(t *testing.T) {
+	e1, e2, e3, e4 := NewServerEndpoint(), NewServerEndpoint(), NewServerEndpoint(), NewServerEndpoint()
+	registry := newEndpointRegistry()
+	assert.Equal(t, []ServerEndpoint{}, registry.all())
+
+	id1 := registry.add(e1)
+	id2 := registry.add(e2)
+	id3 := registry.add(e3)
+	assert.NotEqual(t, id1, id2, "expected unique endpoint IDs")
+	assert.NotEqual(t, id2, id3, "expected unique endpoint IDs")
+	assert.Equal(t, []ServerEndpoint{e1, e2, e3}, registry.all())
+
+	snapshot := registry.all()
+	assert.True(t, registry.replace(id2, e4), "expected endpoint to be replaced")
+	assert.Equal(t, []ServerEndpoint{e1, e4, e3}, registry.all())
+	assert.True(t, registry.remove(id1), "expected endpoint to be removed")
+	assert.Equal(t, []ServerEndpoint{e4, e3}, registry.all())
+	assert.Equal(t, []ServerEndpoint{e1, e2, e3}, snapshot, "snapshot was not expected to change")
+
+	assert.False(t, registry.remove(id1), "endpoint was already removed")
+	assert.False(t, registry.replace(id1, e1), "endpoint was already removed")
+
+	registry.clear()
+	assert.Equal(t, []ServerEndpoint{}, registry.all())
+	assert.False(t, registry.remove(id3), "endpoint was already cleared")
+	assert.NotEqual(t, id3, registry.add(e1), "expected IDs not to be reused after clear")
+}
@@ -1,5 +1,5 @@
 module github.com/jfrog/go-mockhttp
 
-go 1.12
+go 1.15
 
 require github.com/stretchr/testify v1.4.0
@@ -0,0 +1,256 @@
+package mockhttp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR (HTTP Archive) 1.2 format, see: http://www.softwareishard.com/blog/har-12-spec/
+type harLog struct {
+	Log harLogContent `json:"log"`
+}
+
+type harLogContent struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+	// Error is a custom field (custom fields start with an underscore), set when a client returned an error
+	Error string `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// exportHAR writes the given records as an HTTP Archive (HAR 1.2) JSON document
+func exportHAR(w io.Writer, records []requestRecord) error {
+	har := harLog{Log: harLogContent{
+		Version: "1.2",
+		Creator: harCreator{Name: "go-mockhttp"},
+		Entries: make([]harEntry, len(records)),
+	}}
+	for i, record := range records {
+		har.Log.Entries[i] = newHAREntry(record)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(har); err != nil {
+		return fmt.Errorf("could not export HAR: %v", err)
+	}
+	return nil
+}
+
+func newHAREntry(record requestRecord) harEntry {
+	request := record.request
+	entry := harEntry{
+		StartedDateTime: request.ReceivedAt.Format(time.RFC3339Nano),
+		Time:            milliseconds(request.Duration),
+		Request:         newHARRequest(request),
+		Response:        newHARResponse(request.Response, request.Proto),
+	}
+	if !record.accepted {
+		entry.Comment = "unmatched request"
+	} else if request.endpoint != nil {
+		entry.Comment = fmt.Sprintf("endpoint %d: %v", request.EndpointID, request.endpoint)
+	}
+	if request.Response != nil {
+		if request.Response.Error != nil {
+			entry.Error = request.Response.Error.Error()
+		}
+		if !request.Response.SentAt.IsZero() {
+			wait := request.Response.SentAt.Sub(request.ReceivedAt)
+			entry.Timings.Wait = milliseconds(wait)
+			entry.Timings.Receive = milliseconds(request.Duration - wait)
+		}
+	}
+	return entry
+}
+
+func newHARRequest(request RecordedRequest) harRequest {
+	res := harRequest{
+		Method:      request.Method,
+		URL:         harURL(request),
+		HTTPVersion: request.Proto,
+		Cookies:     []harCookie{},
+		Headers:     harHeaders(request.Header),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(request.Body),
+	}
+	for _, cookie := range request.toHttpRequest().Cookies() {
+		res.Cookies = append(res.Cookies, harCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	for _, name := range sortedKeys(request.Query) {
+		for _, value := range request.Query[name] {
+			res.QueryString = append(res.QueryString, harNameValue{Name: name, Value: value})
+		}
+	}
+	if len(request.Body) > 0 {
+		res.PostData = &harPostData{MimeType: request.Header.Get("Content-Type"), Text: string(request.Body)}
+	}
+	return res
+}
+
+// newHARResponse returns the HAR response of the given recorded response. HAR requires a response for each entry, so a
+// missing response (e.g. an error returned by a client) is exported with status 0.
+func newHARResponse(response *RecordedResponse, proto string) harResponse {
+	if response == nil || response.Error != nil {
+		return harResponse{
+			Cookies:     []harCookie{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+	}
+	res := harResponse{
+		Status:      response.StatusCode,
+		StatusText:  http.StatusText(response.StatusCode),
+		HTTPVersion: proto,
+		Cookies:     []harCookie{},
+		Headers:     harHeaders(response.Header),
+		Content: harContent{
+			Size:     response.BodySize,
+			MimeType: response.Header.Get("Content-Type"),
+		},
+		RedirectURL: response.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    response.BodySize,
+	}
+	for _, cookie := range (&http.Response{Header: response.Header}).Cookies() {
+		c := harCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			c.Expires = cookie.Expires.Format(time.RFC3339)
+		}
+		res.Cookies = append(res.Cookies, c)
+	}
+	if utf8.Valid(response.Body) {
+		res.Content.Text = string(response.Body)
+	} else {
+		res.Content.Text = base64.StdEncoding.EncodeToString(response.Body)
+		res.Content.Encoding = "base64"
+	}
+	if response.BodyTruncated {
+		res.Content.Comment = fmt.Sprintf("body truncated to %d bytes", len(response.Body))
+	}
+	return res
+}
+
+func harURL(request RecordedRequest) string {
+	u := url.URL{
+		Scheme:   request.Scheme,
+		Host:     request.Host,
+		Path:     request.Path,
+		RawPath:  request.RawPath,
+		RawQuery: request.Query.Encode(),
+	}
+	return u.String()
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	res := []harNameValue{}
+	for _, name := range sortedKeys(header) {
+		for _, value := range header[name] {
+			res = append(res, harNameValue{Name: name, Value: value})
+		}
+	}
+	return res
+}
+
+func sortedKeys(values map[string][]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func milliseconds(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,124 @@
+package mockhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHAR(t *testing.T) {
+	receivedAt := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	request := func(method, url, body string, header http.Header) RecordedRequest {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header = header
+		recorded := newRecordedRequest(req, receivedAt)
+		return recorded
+	}
+	accepted := request("POST", "http://myhost:8080/items/a%2Fb?b=2&a=1", "hello", http.Header{
+		"Content-Type": {"text/plain"},
+		"Cookie":       {"session=abc"},
+	})
+	accepted.Duration = 30 * time.Millisecond
+	accepted.EndpointID = 3
+	accepted.endpoint = NewServerEndpoint().When(Request().POST("/items/a/b"))
+	accepted.Response = &RecordedResponse{
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"id=1; Path=/; HttpOnly"}},
+		Body:       []byte(`{"id":1}`),
+		BodySize:   8,
+		SentAt:     receivedAt.Add(10 * time.Millisecond),
+	}
+	unmatched := request("GET", "http://myhost:8080/other", "", http.Header{})
+	unmatched.Response = &RecordedResponse{
+		StatusCode:    http.StatusNotFound,
+		Header:        http.Header{},
+		Body:          []byte{0xff, 0xfe},
+		BodyTruncated: true,
+		BodySize:      4,
+		SentAt:        receivedAt,
+	}
+	failed := request("GET", "https://myhost/fail", "", http.Header{})
+	failed.Response = &RecordedResponse{Error: errors.New("dummy error")}
+
+	b := bytes.Buffer{}
+	require.NoError(t, exportHAR(&b, []requestRecord{
+		{request: accepted, accepted: true},
+		{request: unmatched, accepted: false},
+		{request: failed, accepted: true},
+	}))
+
+	doc, err := parseJSON(b.Bytes())
+	require.NoError(t, err, "expected valid JSON")
+	log := doc.(map[string]interface{})["log"].(map[string]interface{})
+	assert.Equal(t, "1.2", log["version"], "unexpected HAR version")
+	assert.Equal(t, map[string]interface{}{"name": "go-mockhttp", "version": ""}, log["creator"], "unexpected creator")
+	entries := log["entries"].([]interface{})
+	require.Equal(t, 3, len(entries), "unexpected number of entries")
+
+	entry := mustToJSONValue(newHAREntry(requestRecord{request: accepted, accepted: true}))
+	assert.Equal(t, mustToJSONValue(map[string]interface{}{
+		"startedDateTime": "2021-03-04T05:06:07Z",
+		"time":            30,
+		"request": map[string]interface{}{
+			"method":      "POST",
+			"url":         "http://myhost:8080/items/a%2Fb?a=1&b=2",
+			"httpVersion": "HTTP/1.1",
+			"cookies":     []interface{}{map[string]interface{}{"name": "session", "value": "abc"}},
+			"headers": []interface{}{
+				map[string]interface{}{"name": "Content-Type", "value": "text/plain"},
+				map[string]interface{}{"name": "Cookie", "value": "session=abc"},
+			},
+			"queryString": []interface{}{
+				map[string]interface{}{"name": "a", "value": "1"},
+				map[string]interface{}{"name": "b", "value": "2"},
+			},
+			"postData":    map[string]interface{}{"mimeType": "text/plain", "text": "hello"},
+			"headersSize": -1,
+			"bodySize":    5,
+		},
+		"response": map[string]interface{}{
+			"status":      201,
+			"statusText":  "Created",
+			"httpVersion": "HTTP/1.1",
+			"cookies":     []interface{}{map[string]interface{}{"name": "id", "value": "1", "path": "/", "httpOnly": true}},
+			"headers": []interface{}{
+				map[string]interface{}{"name": "Content-Type", "value": "application/json"},
+				map[string]interface{}{"name": "Set-Cookie", "value": "id=1; Path=/; HttpOnly"},
+			},
+			"content":     map[string]interface{}{"size": 8, "mimeType": "application/json", "text": `{"id":1}`},
+			"redirectURL": "",
+			"headersSize": -1,
+			"bodySize":    8,
+		},
+		"cache":   map[string]interface{}{},
+		"timings": map[string]interface{}{"send": 0, "wait": 10, "receive": 20},
+		"comment": "endpoint 3: Request(Method(POST),Path(/items/a/b))",
+	}), entry, "unexpected entry of accepted request")
+	assert.Equal(t, entry, entries[0], "unexpected exported entry of accepted request")
+
+	entry = entries[1]
+	assert.Equal(t, "unmatched request", jsonValue(t, entry, "$.comment"), "unexpected comment of unmatched request")
+	assert.Equal(t, json.Number("404"), jsonValue(t, entry, "$.response.status"), "unexpected status of unmatched request")
+	assert.Equal(t, "//4=", jsonValue(t, entry, "$.response.content.text"), "expected binary content to be base64 encoded")
+	assert.Equal(t, "base64", jsonValue(t, entry, "$.response.content.encoding"), "unexpected content encoding")
+	assert.Equal(t, "body truncated to 2 bytes", jsonValue(t, entry, "$.response.content.comment"), "unexpected content comment")
+
+	entry = entries[2]
+	assert.Equal(t, "https://myhost/fail", jsonValue(t, entry, "$.request.url"), "unexpected URL of failed request")
+	assert.Equal(t, json.Number("0"), jsonValue(t, entry, "$.response.status"), "unexpected status of failed request")
+	assert.Equal(t, "dummy error", jsonValue(t, entry, "$._error"), "unexpected error of failed request")
+}
+
+func jsonValue(t *testing.T, doc interface{}, path string) interface{} {
+	p, err := parseJSONPath(path)
+	require.NoError(t, err)
+	value, _ := p.lookup(doc)
+	return value
+}
@@ -0,0 +1,56 @@
+package mockhttp
+
+import (
+	"net/http"
+	"sync"
+)
+
+// invocationLimit limits the number of times an endpoint can be used. The zero value is unlimited. Safe for concurrent
+// use.
+type invocationLimit struct {
+	mtx     sync.Mutex
+	limited bool
+	limit   int
+	used    int
+}
+
+func (l *invocationLimit) set(limit int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.limited = true
+	l.limit = limit
+}
+
+// available returns true if the limit is not reached yet, without using the endpoint
+func (l *invocationLimit) available() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return !l.limited || l.used < l.limit
+}
+
+// tryUse uses the endpoint once if the limit is not reached yet. Returns false if the limit is reached.
+func (l *invocationLimit) tryUse() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.limited && l.used >= l.limit {
+		return false
+	}
+	l.used++
+	return true
+}
+
+// claimer is implemented by endpoints with an invocation limit (see the endpoints' Times function) or a scenario state.
+// A server or client claims a use of an endpoint which matches a request before dispatching the request to it.
+type claimer interface {
+	claim(request *http.Request) bool
+}
+
+// claim claims a use of the given endpoint for the given request. Returns false if the endpoint reached its invocation
+// limit, or its scenario left the required state, meanwhile (e.g. by a concurrent request). Endpoints which do not
+// implement claimer can always be used.
+func claim(endpoint interface{}, request *http.Request) bool {
+	if c, ok := endpoint.(claimer); ok {
+		return c.claim(request)
+	}
+	return true
+}
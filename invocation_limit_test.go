@@ -0,0 +1,52 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInvocationLimit(t *testing.T) {
+	unlimited := invocationLimit{}
+	for i := 0; i < 10; i++ {
+		assert.Truef(t, unlimited.tryUse(), "unlimited use #%d was expected to succeed", i+1)
+	}
+
+	limited := invocationLimit{}
+	limited.set(2)
+	assert.True(t, limited.tryUse(), "use #1 was expected to succeed")
+	assert.True(t, limited.tryUse(), "use #2 was expected to succeed")
+	assert.False(t, limited.tryUse(), "use #3 was expected to fail")
+
+	never := invocationLimit{}
+	never.set(0)
+	assert.False(t, never.tryUse(), "use was expected to fail")
+}
+
+func TestInvocationLimit_Available(t *testing.T) {
+	limit := invocationLimit{}
+	limit.set(1)
+	assert.True(t, limit.available(), "expected to be available before use")
+	assert.True(t, limit.available(), "checking availability was not expected to use the limit")
+	assert.True(t, limit.tryUse(), "use #1 was expected to succeed")
+	assert.False(t, limit.available(), "expected not to be available once the limit is reached")
+}
+
+func TestInvocationLimit_Concurrent(t *testing.T) {
+	limit := invocationLimit{}
+	limit.set(10)
+	var used int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limit.tryUse() {
+				atomic.AddInt32(&used, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(10), used, "unexpected number of successful uses")
+}
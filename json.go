@@ -0,0 +1,222 @@
+package mockhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// toJSONValue converts the given value into its generic JSON representation, the same representation produced by
+// parseJSON (maps, slices, json.Number, string, bool and nil).
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSON(data)
+}
+
+// parseJSON unmarshals a JSON document into an interface{}, keeping numbers as json.Number so large integers (e.g. IDs
+// above 2^53) are not rounded
+func parseJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid character after top-level JSON value")
+	}
+	return value, nil
+}
+
+func mustToJSONValue(v interface{}) interface{} {
+	value, err := toJSONValue(v)
+	if err != nil {
+		panic(fmt.Errorf("could not convert value to JSON: %v", err))
+	}
+	return value
+}
+
+// jsonString returns the compact JSON representation of a generic JSON value (as returned by toJSONValue)
+func jsonString(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// jsonEquals checks whether two generic JSON values are equal. Numbers are compared by their value, so 1, 1.0 and 1e0
+// are equal.
+func jsonEquals(actual, expected interface{}) bool {
+	switch exp := expected.(type) {
+	case map[string]interface{}:
+		act, ok := actual.(map[string]interface{})
+		if !ok || len(act) != len(exp) {
+			return false
+		}
+		for k, v := range exp {
+			actualValue, found := act[k]
+			if !found || !jsonEquals(actualValue, v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		act, ok := actual.([]interface{})
+		if !ok || len(act) != len(exp) {
+			return false
+		}
+		for i := range exp {
+			if !jsonEquals(act[i], exp[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		act, ok := actual.(json.Number)
+		return ok && jsonNumberEquals(act, exp)
+	default:
+		return actual == expected
+	}
+}
+
+// jsonNumberEquals compares two JSON numbers exactly, without converting them to float64
+func jsonNumberEquals(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	x, okX := new(big.Rat).SetString(string(a))
+	y, okY := new(big.Rat).SetString(string(b))
+	return okX && okY && x.Cmp(y) == 0
+}
+
+// jsonContains checks whether expected is a subset of actual.
+//
+// Objects are compared recursively, ignoring fields that exist only in actual. Arrays must be of the same length, and
+// each element is compared recursively. Any other value must be equal.
+func jsonContains(actual, expected interface{}) bool {
+	switch exp := expected.(type) {
+	case map[string]interface{}:
+		act, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range exp {
+			actualValue, found := act[k]
+			if !found || !jsonContains(actualValue, v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		act, ok := actual.([]interface{})
+		if !ok || len(act) != len(exp) {
+			return false
+		}
+		for i := range exp {
+			if !jsonContains(act[i], exp[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return jsonEquals(actual, expected)
+	}
+}
+
+// jsonPath is a parsed (simplified) JSONPath expression, pointing to a single value in a JSON document.
+//
+// Supported syntax is the root element ($) followed by any number of:
+//   .field
+//   ['field']
+//   [index]
+// For example: $.items[0].id
+type jsonPath []jsonPathElement
+
+type jsonPathElement struct {
+	field string
+	index int
+	isIdx bool
+}
+
+func parseJSONPath(path string) (jsonPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid JSON path '%s': must start with '$'", path)
+	}
+	res := jsonPath{}
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			field := rest[1 : end+1]
+			if field == "" {
+				return nil, fmt.Errorf("invalid JSON path '%s': empty field name", path)
+			}
+			res = append(res, jsonPathElement{field: field})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path '%s': missing ']'", path)
+			}
+			selector := rest[1:end]
+			if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				res = append(res, jsonPathElement{field: selector[1 : len(selector)-1]})
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSON path '%s': invalid selector [%s]", path, selector)
+				}
+				res = append(res, jsonPathElement{index: index, isIdx: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path '%s': unexpected character '%c'", path, rest[0])
+		}
+	}
+	return res, nil
+}
+
+// lookup finds the value the path points to in the given JSON document. Negative indices count from the end of an
+// array. Returns false if there is no such value.
+func (p jsonPath) lookup(doc interface{}) (interface{}, bool) {
+	current := doc
+	for _, elem := range p {
+		if elem.isIdx {
+			arr, ok := current.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			index := elem.index
+			if index < 0 {
+				index = len(arr) + index
+			}
+			if index < 0 || index >= len(arr) {
+				return nil, false
+			}
+			current = arr[index]
+		} else {
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			value, found := obj[elem.field]
+			if !found {
+				return nil, false
+			}
+			current = value
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,61 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    jsonPath
+		wantErr bool
+	}{
+		{path: "$", want: jsonPath{}},
+		{path: "$.foo", want: jsonPath{{field: "foo"}}},
+		{path: "$.foo.bar", want: jsonPath{{field: "foo"}, {field: "bar"}}},
+		{path: "$.items[3].id", want: jsonPath{{field: "items"}, {index: 3, isIdx: true}, {field: "id"}}},
+		{path: "$[-1]", want: jsonPath{{index: -1, isIdx: true}}},
+		{path: "$['foo bar'][\"baz\"]", want: jsonPath{{field: "foo bar"}, {field: "baz"}}},
+		{path: "foo", wantErr: true},
+		{path: "$..foo", wantErr: true},
+		{path: "$.foo[1", wantErr: true},
+		{path: "$.foo[bar]", wantErr: true},
+		{path: "$foo", wantErr: true},
+	}
+	for _, testCase := range tests {
+		path, err := parseJSONPath(testCase.path)
+		if testCase.wantErr {
+			assert.Errorf(t, err, "expected an error for path: %s", testCase.path)
+		} else if assert.NoErrorf(t, err, "unexpected error for path: %s", testCase.path) {
+			assert.Equalf(t, testCase.want, path, "unexpected parsed path for: %s", testCase.path)
+		}
+	}
+}
+
+func TestJSONEquals(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: `1`, b: `1.0`, want: true},
+		{a: `100`, b: `1e2`, want: true},
+		{a: `0.1`, b: `0.10`, want: true},
+		{a: `9007199254740993`, b: `9007199254740992`, want: false},
+		{a: `{"a":[1,"x",null,true]}`, b: `{"a":[1.0,"x",null,true]}`, want: true},
+		{a: `{"a":1}`, b: `{"a":1,"b":2}`, want: false},
+		{a: `[1,2]`, b: `[2,1]`, want: false},
+		{a: `"1"`, b: `1`, want: false},
+	}
+	for _, testCase := range tests {
+		a, err := parseJSON([]byte(testCase.a))
+		require.NoError(t, err)
+		b, err := parseJSON([]byte(testCase.b))
+		require.NoError(t, err)
+		assert.Equalf(t, testCase.want, jsonEquals(a, b), "unexpected result comparing %s and %s", testCase.a, testCase.b)
+		assert.Equalf(t, testCase.want, jsonEquals(b, a), "unexpected result comparing %s and %s", testCase.b, testCase.a)
+	}
+	_, err := parseJSON([]byte(`{"a":1} {"b":2}`))
+	assert.Error(t, err, "expected an error for trailing data")
+}
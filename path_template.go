@@ -0,0 +1,132 @@
+package mockhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// pathTemplate is a parsed path template, such as: /api/repos/{repo}/items/{id...}
+//
+// Each path segment in the template is either a literal, a named parameter ({name}) which matches exactly one
+// non-empty segment, or a trailing wildcard ({name...}) which matches the remainder of the path (possibly empty).
+type pathTemplate struct {
+	template string
+	segments []pathTemplateSegment
+}
+
+type pathTemplateSegment struct {
+	literal  string
+	param    string
+	wildcard bool
+}
+
+func parsePathTemplate(template string) (*pathTemplate, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("invalid path template '%s': must start with '/'", template)
+	}
+	parts := strings.Split(template[1:], "/")
+	segments := make([]pathTemplateSegment, len(parts))
+	names := map[string]bool{}
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") && !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("invalid path template '%s': a parameter must be a whole segment: %s", template, part)
+			}
+			segments[i] = pathTemplateSegment{literal: part}
+			continue
+		}
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			return nil, fmt.Errorf("invalid path template '%s': a parameter must be a whole segment: %s", template, part)
+		}
+		name := part[1 : len(part)-1]
+		wildcard := strings.HasSuffix(name, "...")
+		if wildcard {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("invalid path template '%s': wildcard parameter must be the last segment: %s", template, part)
+			}
+			name = strings.TrimSuffix(name, "...")
+		}
+		if name == "" || strings.ContainsAny(name, "{}") {
+			return nil, fmt.Errorf("invalid path template '%s': invalid parameter name: %s", template, part)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("invalid path template '%s': duplicate parameter name: %s", template, name)
+		}
+		names[name] = true
+		segments[i] = pathTemplateSegment{param: name, wildcard: wildcard}
+	}
+	return &pathTemplate{template: template, segments: segments}, nil
+}
+
+// match matches the given path against the template, and returns the captured path parameters if it matches
+func (t *pathTemplate) match(path string) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	parts := strings.Split(path[1:], "/")
+	last := t.segments[len(t.segments)-1]
+	if last.wildcard {
+		if len(parts) < len(t.segments) {
+			return nil, false
+		}
+	} else if len(parts) != len(t.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range t.segments {
+		switch {
+		case segment.wildcard:
+			params[segment.param] = strings.Join(parts[i:], "/")
+		case segment.param != "":
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[segment.param] = parts[i]
+		case segment.literal != parts[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (t *pathTemplate) String() string {
+	return t.template
+}
+
+type pathParamsKey struct{}
+
+func withPathParams(request *http.Request, params map[string]string) *http.Request {
+	if len(params) == 0 {
+		return request
+	}
+	return request.WithContext(context.WithValue(request.Context(), pathParamsKey{}, params))
+}
+
+// PathParams returns the path parameters captured by the PathTemplate request matcher of the endpoint handling the
+// given request. Returns an empty map if there are no path parameters.
+//
+// To be used in custom handlers of server endpoints (HandleWith) and client endpoints. For example:
+//   NewServerEndpoint().
+//   	When(Request().PathTemplate("/repos/{repo}/items/{id}")).
+//   	HandleWith(func(response http.ResponseWriter, request *http.Request) {
+//   		params := PathParams(request)
+//   		_, _ = response.Write([]byte(params["repo"] + ":" + params["id"]))
+//   	})
+func PathParams(request *http.Request) map[string]string {
+	res := map[string]string{}
+	if params, ok := request.Context().Value(pathParamsKey{}).(map[string]string); ok {
+		for k, v := range params {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// PathParam returns the value of a single path parameter, captured by the PathTemplate request matcher of the endpoint
+// handling the given request. Returns an empty string if there is no such path parameter.
+func PathParam(request *http.Request, name string) string {
+	return PathParams(request)[name]
+}
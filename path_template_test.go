@@ -0,0 +1,67 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestPathTemplate_Match(t *testing.T) {
+	tests := []struct {
+		template   string
+		path       string
+		want       bool
+		wantParams map[string]string
+	}{
+		{template: "/foo/bar", path: "/foo/bar", want: true, wantParams: map[string]string{}},
+		{template: "/foo/bar", path: "/foo/baz", want: false},
+		{template: "/foo/{id}", path: "/foo/123", want: true, wantParams: map[string]string{"id": "123"}},
+		{template: "/foo/{id}", path: "/foo/", want: false},
+		{template: "/foo/{id}", path: "/foo/123/bar", want: false},
+		{template: "/repos/{repo}/items/{id}", path: "/repos/r1/items/i1", want: true, wantParams: map[string]string{"repo": "r1", "id": "i1"}},
+		{template: "/repos/{repo}/items/{id...}", path: "/repos/r1/items/a/b/c", want: true, wantParams: map[string]string{"repo": "r1", "id": "a/b/c"}},
+		{template: "/repos/{repo}/items/{id...}", path: "/repos/r1/items/", want: true, wantParams: map[string]string{"repo": "r1", "id": ""}},
+		{template: "/repos/{repo}/items/{id...}", path: "/repos/r1/items", want: false},
+		{template: "/repos/{repo}/items/{id...}", path: "/repos/r1/files/a", want: false},
+		{template: "/{any...}", path: "/", want: true, wantParams: map[string]string{"any": ""}},
+	}
+	for _, testCase := range tests {
+		template, err := parsePathTemplate(testCase.template)
+		require.NoError(t, err)
+		params, matches := template.match(testCase.path)
+		assert.Equalf(t, testCase.want, matches, "unexpected match result. template: %s, path: %s", testCase.template, testCase.path)
+		if testCase.want {
+			assert.Equalf(t, testCase.wantParams, params, "unexpected params. template: %s, path: %s", testCase.template, testCase.path)
+		}
+	}
+}
+
+func TestPathTemplate_Invalid(t *testing.T) {
+	templates := []string{
+		"foo/{id}",
+		"/foo/{id...}/bar",
+		"/foo/{}",
+		"/foo/{id",
+		"/foo/id}",
+		"/foo/a{id}",
+		"/foo/{id}/{id}",
+		"/foo/{...}",
+	}
+	for _, template := range templates {
+		_, err := parsePathTemplate(template)
+		assert.Errorf(t, err, "expected an error for an invalid template: %s", template)
+	}
+}
+
+func TestPathParams(t *testing.T) {
+	request := &http.Request{URL: &url.URL{Path: "/foo"}}
+	assert.Equal(t, map[string]string{}, PathParams(request))
+	assert.Equal(t, "", PathParam(request, "id"))
+
+	request = withPathParams(request, map[string]string{"id": "123"})
+	assert.Equal(t, map[string]string{"id": "123"}, PathParams(request))
+	assert.Equal(t, "123", PathParam(request, "id"))
+	assert.Equal(t, "", PathParam(request, "other"))
+}
@@ -1,16 +1,23 @@
 package mockhttp
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 )
 
 type requestMatcherFunc func(request *http.Request) bool
 
+// pathParamsFunc returns the path parameters captured from a request, by a path template or a combinator of matchers
+// with path templates
+type pathParamsFunc func(request *http.Request) map[string]string
+
 type requestMatcher struct {
 	requestMatchers []requestMatcherFunc
 	description     string
+	pathParamsFuncs []pathParamsFunc
 }
 
 // Request creates a new request matcher. By default it matches everything. Use configuration methods to narrow down what matches
@@ -25,6 +32,98 @@ func Request() *requestMatcher {
 	return &requestMatcher{}
 }
 
+// AnyOf creates a new request matcher which matches requests that match at least one of the given request matchers
+// (OR). With no matchers given, it matches nothing. Panics if any of the given matchers is nil.
+//
+// For example:
+//   AnyOf(Request().Method("GET"), Request().Method("HEAD"))
+func AnyOf(matchers ...*requestMatcher) *requestMatcher {
+	children := copyOfMatchers("AnyOf", matchers)
+	m := Request()
+	// path parameters are captured only by the first child which matches the request
+	m.appendPathParamsFunc(children, func(request *http.Request) map[string]string {
+		for _, child := range children {
+			if child.matches(request) {
+				return child.pathParams(request)
+			}
+		}
+		return nil
+	})
+	m.appendMatcher(fmt.Sprintf("AnyOf(%s)", joinDescriptions(children)), func(request *http.Request) bool {
+		for _, child := range children {
+			if child.matches(request) {
+				return true
+			}
+		}
+		return false
+	})
+	return m
+}
+
+// AllOf creates a new request matcher which matches requests that match all of the given request matchers (AND).
+// With no matchers given, it matches everything. Panics if any of the given matchers is nil.
+//
+// For example:
+//   AllOf(Request().Path("/foo"), AnyOf(Request().Method("GET"), Request().Method("HEAD")))
+func AllOf(matchers ...*requestMatcher) *requestMatcher {
+	children := copyOfMatchers("AllOf", matchers)
+	m := Request()
+	m.appendPathParamsFunc(children, func(request *http.Request) map[string]string {
+		params := map[string]string{}
+		for _, child := range children {
+			for k, v := range child.pathParams(request) {
+				params[k] = v
+			}
+		}
+		return params
+	})
+	m.appendMatcher(fmt.Sprintf("AllOf(%s)", joinDescriptions(children)), func(request *http.Request) bool {
+		for _, child := range children {
+			if !child.matches(request) {
+				return false
+			}
+		}
+		return true
+	})
+	return m
+}
+
+// Not creates a new request matcher which matches requests that do not match the given request matcher. Panics if the
+// given matcher is nil.
+//
+// For example:
+//   Not(Request().Header("Authorization", "secret"))
+func Not(matcher *requestMatcher) *requestMatcher {
+	if matcher == nil {
+		panic(fmt.Errorf("Not: matcher is nil"))
+	}
+	child := *matcher
+	m := Request()
+	m.appendMatcher(fmt.Sprintf("Not(%s)", child.String()), func(request *http.Request) bool {
+		return !child.matches(request)
+	})
+	return m
+}
+
+func copyOfMatchers(combinator string, matchers []*requestMatcher) []requestMatcher {
+	res := make([]requestMatcher, len(matchers))
+	for i, matcher := range matchers {
+		if matcher == nil {
+			panic(fmt.Errorf("%s: matcher at index %d is nil", combinator, i))
+		}
+		res[i] = *matcher
+	}
+	return res
+}
+
+func joinDescriptions(matchers []requestMatcher) string {
+	descriptions := make([]string, len(matchers))
+	for i, matcher := range matchers {
+		descriptions[i] = matcher.String()
+	}
+	return strings.Join(descriptions, ",")
+}
+
 func (m *requestMatcher) matches(request *http.Request) bool {
 	if m.requestMatchers != nil {
 		for _, matches := range m.requestMatchers {
@@ -60,6 +159,38 @@ func (m *requestMatcher) PathMatches(path *regexp.Regexp) *requestMatcher {
 	return m
 }
 
+// PathTemplate matches requests with path that matches the given path template, and captures the path parameters.
+// Panics if the template is invalid.
+//
+// Each segment of the template is either a literal, a named parameter ({name}) which matches exactly one non-empty
+// path segment, or a trailing wildcard parameter ({name...}) which matches the remainder of the path. For example:
+//   PathTemplate("/api/repos/{repo}/items/{id...}")
+// Matches "/api/repos/foo/items/a/b/c", capturing repo="foo" and id="a/b/c".
+//
+// The captured path parameters are available to custom handlers using PathParams (or PathParam), and to responses
+// using the response's ExpandPathParams.
+func (m *requestMatcher) PathTemplate(template string) *requestMatcher {
+	parsedTemplate, err := parsePathTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+	m.pathParamsFuncs = append(m.pathParamsFuncs, func(request *http.Request) map[string]string {
+		if request.URL == nil {
+			return nil
+		}
+		params, _ := parsedTemplate.match(request.URL.Path)
+		return params
+	})
+	m.appendMatcher(fmt.Sprintf("PathTemplate(%s)", template), func(request *http.Request) bool {
+		if request.URL == nil {
+			return false
+		}
+		_, matches := parsedTemplate.match(request.URL.Path)
+		return matches
+	})
+	return m
+}
+
 // GET request with the given path.
 //   GET("/foo")
 // Which is a shortcut for:
@@ -140,6 +271,135 @@ func (m *requestMatcher) NoQuery(key string) *requestMatcher {
 	return m
 }
 
+// Body matches requests with the given body (exact match)
+//
+// The request body is buffered for matching, and restored so it can still be read by the endpoint's handler.
+func (m *requestMatcher) Body(body []byte) *requestMatcher {
+	m.appendMatcher(fmt.Sprintf("Body(%s)", body), func(request *http.Request) bool {
+		return bytes.Equal(readRequestBody(request), body)
+	})
+	return m
+}
+
+// BodyString matches requests with the given body as string (exact match)
+func (m *requestMatcher) BodyString(body string) *requestMatcher {
+	m.appendMatcher(fmt.Sprintf("BodyString(%s)", body), func(request *http.Request) bool {
+		return string(readRequestBody(request)) == body
+	})
+	return m
+}
+
+// BodyContains matches requests with a body that contains the given string
+func (m *requestMatcher) BodyContains(substr string) *requestMatcher {
+	m.appendMatcher(fmt.Sprintf("BodyContains(%s)", substr), func(request *http.Request) bool {
+		return strings.Contains(string(readRequestBody(request)), substr)
+	})
+	return m
+}
+
+// BodyMatches matches requests with a body that matches the given regular expression
+func (m *requestMatcher) BodyMatches(body *regexp.Regexp) *requestMatcher {
+	m.appendMatcher(fmt.Sprintf("BodyMatches(%s)", body), func(request *http.Request) bool {
+		return body.Match(readRequestBody(request))
+	})
+	return m
+}
+
+// BodyFunc matches requests with a body for which the given predicate returns true. A request without a body is
+// evaluated as an empty body.
+//
+// For example:
+//   BodyFunc(func(body []byte) bool {
+//   	return len(body) > 1024
+//   })
+func (m *requestMatcher) BodyFunc(predicate func(body []byte) bool) *requestMatcher {
+	m.appendMatcher("BodyFunc()", func(request *http.Request) bool {
+		body := readRequestBody(request)
+		if body == nil {
+			body = []byte{}
+		}
+		return predicate(body)
+	})
+	return m
+}
+
+// BodyJSON matches requests with a JSON body which is semantically equal to the given value, ignoring whitespace and
+// the order of object keys. The value is marshalled to JSON, to provide a raw JSON document use json.RawMessage.
+//
+// For example:
+//   BodyJSON(map[string]interface{}{"name": "foo", "tags": []string{"a", "b"}})
+//   BodyJSON(json.RawMessage(`{"name": "foo", "tags": ["a", "b"]}`))
+func (m *requestMatcher) BodyJSON(v interface{}) *requestMatcher {
+	expected := mustToJSONValue(v)
+	m.appendMatcher(fmt.Sprintf("BodyJSON(%s)", jsonString(expected)), func(request *http.Request) bool {
+		actual, err := parseJSON(readRequestBody(request))
+		return err == nil && jsonEquals(actual, expected)
+	})
+	return m
+}
+
+// BodyJSONSubset matches requests with a JSON body which contains the given value. Fields of JSON objects which are
+// not part of the given value are ignored (recursively), arrays must have the same length and their elements are
+// compared the same way. The value is marshalled to JSON, to provide a raw JSON document use json.RawMessage.
+//
+// For example, the following matches a body {"name": "foo", "id": 7, "meta": {"owner": "bar", "size": 3}}:
+//   BodyJSONSubset(json.RawMessage(`{"name": "foo", "meta": {"owner": "bar"}}`))
+func (m *requestMatcher) BodyJSONSubset(v interface{}) *requestMatcher {
+	expected := mustToJSONValue(v)
+	m.appendMatcher(fmt.Sprintf("BodyJSONSubset(%s)", jsonString(expected)), func(request *http.Request) bool {
+		actual, err := parseJSON(readRequestBody(request))
+		return err == nil && jsonContains(actual, expected)
+	})
+	return m
+}
+
+// BodyJSONPath matches requests with a JSON body, in which the value at the given path is semantically equal to the
+// given value (marshalled to JSON). Panics if the path is invalid.
+//
+// The path supports a simplified JSONPath syntax, pointing at a single value: the root element ($) followed by
+// fields (.name or ['name']) and array indices ([0], negative indices count from the end). For example:
+//   BodyJSONPath("$.items[0].id", 42)
+//   BodyJSONPath("$['display name']", "foo")
+func (m *requestMatcher) BodyJSONPath(path string, v interface{}) *requestMatcher {
+	parsedPath, err := parseJSONPath(path)
+	if err != nil {
+		panic(err)
+	}
+	expected := mustToJSONValue(v)
+	m.appendMatcher(fmt.Sprintf("BodyJSONPath(%s: %s)", path, jsonString(expected)), func(request *http.Request) bool {
+		actual, err := parseJSON(readRequestBody(request))
+		if err != nil {
+			return false
+		}
+		value, found := parsedPath.lookup(actual)
+		return found && jsonEquals(value, expected)
+	})
+	return m
+}
+
+// pathParams returns the path parameters captured by the path templates of this matcher which match the given request.
+// With AnyOf, only the path templates of the first matcher which matches the request are used.
+func (m *requestMatcher) pathParams(request *http.Request) map[string]string {
+	params := map[string]string{}
+	for _, captured := range m.pathParamsFuncs {
+		for k, v := range captured(request) {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// appendPathParamsFunc adds the given function capturing path parameters, if any of the given matchers (combined by
+// this matcher) has path templates
+func (m *requestMatcher) appendPathParamsFunc(matchers []requestMatcher, pathParams pathParamsFunc) {
+	for _, matcher := range matchers {
+		if len(matcher.pathParamsFuncs) > 0 {
+			m.pathParamsFuncs = append(m.pathParamsFuncs, pathParams)
+			return
+		}
+	}
+}
+
 func (m *requestMatcher) appendMatcher(desc string, matcher requestMatcherFunc) {
 	if len(m.description) > 0 {
 		m.description = m.description + ","
@@ -1,10 +1,14 @@
 package mockhttp
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -180,6 +184,55 @@ func TestRequestMatcher_PathMatches(t *testing.T) {
 	}
 }
 
+func TestRequestMatcher_PathTemplate(t *testing.T) {
+	tests := []struct {
+		request    http.Request
+		want       bool
+		wantParams map[string]string
+	}{
+		{
+			request:    http.Request{URL: &url.URL{Path: "/api/repos/foo/items/a/b"}},
+			want:       true,
+			wantParams: map[string]string{"repo": "foo", "id": "a/b"},
+		},
+		{
+			request:    http.Request{URL: &url.URL{Path: "/api/repos/foo/files/a"}},
+			want:       false,
+			wantParams: map[string]string{},
+		},
+		{
+			request:    http.Request{},
+			want:       false,
+			wantParams: map[string]string{},
+		},
+	}
+	matcher := Request().PathTemplate("/api/repos/{repo}/items/{id...}")
+	for _, testCase := range tests {
+		assert.Equalf(t, testCase.want, matcher.matches(&testCase.request), "request match not as expected. want match: %b, request: %+v", testCase.want, testCase.request)
+		assert.Equalf(t, testCase.wantParams, matcher.pathParams(&testCase.request), "unexpected path params. request: %+v", testCase.request)
+	}
+	assert.Equal(t, "PathTemplate(/api/repos/{repo}/items/{id...})", matcher.String())
+	assert.Panics(t, func() { Request().PathTemplate("/foo/{id...}/bar") }, "expected a panic for an invalid template")
+}
+
+func TestRequestMatcher_PathTemplateInCombinators(t *testing.T) {
+	matcher := AllOf(Request().Method("GET"), AnyOf(Request().PathTemplate("/users/{user}"), Request().PathTemplate("/groups/{group}")))
+	request := http.Request{Method: "GET", URL: &url.URL{Path: "/groups/admins"}}
+	assert.True(t, matcher.matches(&request))
+	assert.Equal(t, map[string]string{"group": "admins"}, matcher.pathParams(&request))
+	assert.Equal(t, map[string]string{}, Not(Request().PathTemplate("/users/{user}")).pathParams(&request))
+
+	// only the branch which matches the request captures path parameters
+	matcher = AnyOf(Request().Method("POST").PathTemplate("/a/{id}"), Request().PathTemplate("/{x}/{y}"))
+	request = http.Request{Method: "GET", URL: &url.URL{Path: "/a/7"}}
+	assert.True(t, matcher.matches(&request))
+	assert.Equal(t, map[string]string{"x": "a", "y": "7"}, matcher.pathParams(&request))
+	request.Method = "POST"
+	assert.Equal(t, map[string]string{"id": "7"}, matcher.pathParams(&request))
+	matcher = AnyOf(Request().PathTemplate("/a/{id}"), Request().PathTemplate("/{id}/{x}"))
+	assert.Equal(t, map[string]string{"id": "7"}, matcher.pathParams(&request))
+}
+
 func TestRequestMatcher_Header(t *testing.T) {
 	tests := []struct {
 		request http.Request
@@ -345,3 +398,278 @@ func TestRequestMatcher_NoQuery(t *testing.T) {
 		assert.Equalf(t, testCase.want, Request().NoQuery("foo").matches(&testCase.request), "request match not as expected. want match: %b, request: %+v", testCase.want, testCase.request)
 	}
 }
+
+func TestRequestMatcher_Body(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher *requestMatcher
+		body    string
+		want    bool
+	}{
+		{name: "Body", matcher: Request().Body([]byte("hello world")), body: "hello world", want: true},
+		{name: "Body", matcher: Request().Body([]byte("hello world")), body: "hello", want: false},
+		{name: "Body", matcher: Request().Body([]byte{}), body: "", want: true},
+		{name: "BodyString", matcher: Request().BodyString("hello world"), body: "hello world", want: true},
+		{name: "BodyString", matcher: Request().BodyString("hello world"), body: "hello world!", want: false},
+		{name: "BodyContains", matcher: Request().BodyContains("lo wo"), body: "hello world", want: true},
+		{name: "BodyContains", matcher: Request().BodyContains("lo wo"), body: "hello, world", want: false},
+		{name: "BodyMatches", matcher: Request().BodyMatches(regexp.MustCompile("^h.+d$")), body: "hello world", want: true},
+		{name: "BodyMatches", matcher: Request().BodyMatches(regexp.MustCompile("^h.+d$")), body: "hello world!", want: false},
+		{name: "BodyFunc", matcher: Request().BodyFunc(func(body []byte) bool { return len(body) == 11 }), body: "hello world", want: true},
+		{name: "BodyFunc", matcher: Request().BodyFunc(func(body []byte) bool { return len(body) == 11 }), body: "hello", want: false},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := requestWithBody(testCase.body)
+			assert.Equalf(t, testCase.want, testCase.matcher.matches(&req), "request match not as expected. want match: %b, matcher: %s, body: %s", testCase.want, testCase.matcher, testCase.body)
+			assert.Equal(t, testCase.body, string(MustReadAll(t, req.Body)), "request body was expected to be restored after matching")
+		})
+	}
+}
+
+func TestRequestMatcher_BodyWithoutBody(t *testing.T) {
+	assert.True(t, Request().BodyString("").matches(&http.Request{}), "request without a body was expected to match an empty body")
+	assert.False(t, Request().BodyContains("foo").matches(&http.Request{}), "request without a body was not expected to match")
+	assert.True(t, Request().BodyFunc(func(body []byte) bool { return body != nil && len(body) == 0 }).matches(&http.Request{}), "request without a body was expected to be evaluated as an empty body")
+}
+
+func TestRequestMatcher_BodyJSON(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{
+			body: `{"name":"foo","tags":["a","b"],"size":3}`,
+			want: true,
+		},
+		{
+			body: `{ "size": 3.0, "tags": [ "a", "b" ], "name": "foo" }`,
+			want: true,
+		},
+		{
+			body: `{"name":"foo","tags":["b","a"],"size":3}`,
+			want: false,
+		},
+		{
+			body: `{"name":"foo","tags":["a","b"],"size":3,"extra":true}`,
+			want: false,
+		},
+		{
+			body: `not a json`,
+			want: false,
+		},
+	}
+	matchers := []*requestMatcher{
+		Request().BodyJSON(map[string]interface{}{"name": "foo", "tags": []string{"a", "b"}, "size": 3}),
+		Request().BodyJSON(json.RawMessage(`{"tags": ["a", "b"], "name": "foo", "size": 3}`)),
+	}
+	for _, matcher := range matchers {
+		for _, testCase := range tests {
+			req := requestWithBody(testCase.body)
+			assert.Equalf(t, testCase.want, matcher.matches(&req), "request match not as expected. want match: %b, matcher: %s, body: %s", testCase.want, matcher, testCase.body)
+		}
+	}
+	assert.False(t, matchers[0].matches(&http.Request{}), "request without a body was not expected to match")
+	assert.Equal(t, `BodyJSON({"name":"foo","size":3,"tags":["a","b"]})`, matchers[1].String())
+}
+
+func TestRequestMatcher_BodyJSONLargeIntegers(t *testing.T) {
+	body := `{"id":9007199254740993,"items":[{"id":9007199254740993}]}`
+	matchers := []*requestMatcher{
+		Request().BodyJSON(json.RawMessage(`{"id":9007199254740992,"items":[{"id":9007199254740993}]}`)),
+		Request().BodyJSONSubset(json.RawMessage(`{"id":9007199254740992}`)),
+		Request().BodyJSONPath("$.items[0].id", uint64(9007199254740992)),
+	}
+	for _, matcher := range matchers {
+		req := requestWithBody(body)
+		assert.Falsef(t, matcher.matches(&req), "request was not expected to match: %s", matcher)
+	}
+	matchers = []*requestMatcher{
+		Request().BodyJSON(json.RawMessage(`{"id":9007199254740993,"items":[{"id":9007199254740993}]}`)),
+		Request().BodyJSONSubset(json.RawMessage(`{"id":9007199254740993}`)),
+		Request().BodyJSONPath("$.items[0].id", uint64(9007199254740993)),
+	}
+	for _, matcher := range matchers {
+		req := requestWithBody(body)
+		assert.Truef(t, matcher.matches(&req), "request was expected to match: %s", matcher)
+	}
+}
+
+func TestRequestMatcher_BodyJSONSubset(t *testing.T) {
+	tests := []struct {
+		request http.Request
+		want    bool
+	}{
+		{
+			request: requestWithBody(`{"name":"foo","meta":{"owner":"bar","size":3},"items":[{"id":1},{"id":2}]}`),
+			want:    true,
+		},
+		{
+			request: requestWithBody(`{"name":"foo","id":7,"meta":{"owner":"bar","size":3,"x":"y"},"items":[{"id":1,"a":"b"},{"id":2}]}`),
+			want:    true,
+		},
+		{
+			request: requestWithBody(`{"name":"foo","meta":{"size":3},"items":[{"id":1},{"id":2}]}`),
+			want:    false,
+		},
+		{
+			request: requestWithBody(`{"name":"foo","meta":{"owner":"bar"},"items":[{"id":1}]}`),
+			want:    false,
+		},
+		{
+			request: requestWithBody(`["foo"]`),
+			want:    false,
+		},
+		{
+			request: http.Request{},
+			want:    false,
+		},
+	}
+	matcher := Request().BodyJSONSubset(json.RawMessage(`{"name": "foo", "meta": {"owner": "bar"}, "items": [{"id": 1}, {}]}`))
+	for _, testCase := range tests {
+		req := testCase.request
+		assert.Equalf(t, testCase.want, matcher.matches(&req), "request match not as expected. want match: %b, body: %s", testCase.want, bodyOf(req))
+	}
+	assert.Equal(t, `BodyJSONSubset({"items":[{"id":1},{}],"meta":{"owner":"bar"},"name":"foo"})`, matcher.String())
+}
+
+func TestRequestMatcher_BodyJSONPath(t *testing.T) {
+	body := `{"items":[{"id":5,"name":"foo"},{"id":7,"tags":["a","b"]}],"display name":"bar"}`
+	tests := []struct {
+		path  string
+		value interface{}
+		want  bool
+	}{
+		{path: "$.items[0].id", value: 5, want: true},
+		{path: "$.items[0].id", value: 7, want: false},
+		{path: "$.items[-1].id", value: 7, want: true},
+		{path: "$.items[1].tags", value: []string{"a", "b"}, want: true},
+		{path: "$.items[1]['tags'][1]", value: "b", want: true},
+		{path: "$['display name']", value: "bar", want: true},
+		{path: "$.items[0]", value: map[string]interface{}{"name": "foo", "id": 5}, want: true},
+		{path: "$.items[2].id", value: 5, want: false},
+		{path: "$.missing", value: nil, want: false},
+		{path: "$.items.id", value: 5, want: false},
+	}
+	for _, testCase := range tests {
+		req := requestWithBody(body)
+		matcher := Request().BodyJSONPath(testCase.path, testCase.value)
+		assert.Equalf(t, testCase.want, matcher.matches(&req), "request match not as expected. want match: %b, matcher: %s", testCase.want, matcher)
+	}
+	assert.Equal(t, `BodyJSONPath($.items[0].id: 5)`, Request().BodyJSONPath("$.items[0].id", 5).String())
+	assert.Panics(t, func() { Request().BodyJSONPath("items[0]", 5) }, "expected a panic for an invalid path")
+}
+
+func requestWithBody(body string) http.Request {
+	return http.Request{Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+func bodyOf(request http.Request) string {
+	return string(readRequestBody(&request))
+}
+
+func TestRequestMatcher_AnyOf(t *testing.T) {
+	tests := []struct {
+		request http.Request
+		want    bool
+	}{
+		{
+			request: http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}},
+			want:    true,
+		},
+		{
+			request: http.Request{Method: "HEAD", URL: &url.URL{Path: "/bar"}},
+			want:    true,
+		},
+		{
+			request: http.Request{Method: "DELETE", URL: &url.URL{Path: "/bar"}},
+			want:    false,
+		},
+	}
+	matcher := AnyOf(Request().Method("GET"), Request().Method("HEAD"))
+	for _, testCase := range tests {
+		assert.Equalf(t, testCase.want, matcher.matches(&testCase.request), "request match not as expected. want match: %b, request: %+v", testCase.want, testCase.request)
+	}
+	assert.Equal(t, "AnyOf(Method(GET),Method(HEAD))", matcher.String())
+	assert.False(t, AnyOf().matches(&http.Request{}), "empty AnyOf was not expected to match")
+}
+
+func TestRequestMatcher_AllOf(t *testing.T) {
+	tests := []struct {
+		request http.Request
+		want    bool
+	}{
+		{
+			request: http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}},
+			want:    true,
+		},
+		{
+			request: http.Request{Method: "HEAD", URL: &url.URL{Path: "/foo"}},
+			want:    true,
+		},
+		{
+			request: http.Request{Method: "HEAD", URL: &url.URL{Path: "/bar"}},
+			want:    false,
+		},
+		{
+			request: http.Request{Method: "PUT", URL: &url.URL{Path: "/foo"}},
+			want:    false,
+		},
+	}
+	matcher := AllOf(Request().Path("/foo"), AnyOf(Request().Method("GET"), Request().Method("HEAD")))
+	for _, testCase := range tests {
+		assert.Equalf(t, testCase.want, matcher.matches(&testCase.request), "request match not as expected. want match: %b, request: %+v", testCase.want, testCase.request)
+	}
+	assert.Equal(t, "AllOf(Path(/foo),AnyOf(Method(GET),Method(HEAD)))", matcher.String())
+	assert.True(t, AllOf().matches(&http.Request{}), "empty AllOf was expected to match")
+}
+
+func TestRequestMatcher_Not(t *testing.T) {
+	tests := []struct {
+		request http.Request
+		want    bool
+	}{
+		{
+			request: http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}},
+			want:    false,
+		},
+		{
+			request: http.Request{Method: "GET", URL: &url.URL{Path: "/bar"}},
+			want:    true,
+		},
+		{
+			request: http.Request{Method: "POST", URL: &url.URL{Path: "/foo"}},
+			want:    true,
+		},
+	}
+	matcher := Not(Request().GET("/foo"))
+	for _, testCase := range tests {
+		assert.Equalf(t, testCase.want, matcher.matches(&testCase.request), "request match not as expected. want match: %b, request: %+v", testCase.want, testCase.request)
+	}
+	assert.Equal(t, "Not(Method(GET),Path(/foo))", matcher.String())
+}
+
+func TestRequestMatcher_CombinatorsRejectNilMatchers(t *testing.T) {
+	assert.Equal(t, "AnyOf: matcher at index 1 is nil", panicMessage(func() { AnyOf(Request(), nil) }))
+	assert.Equal(t, "AllOf: matcher at index 0 is nil", panicMessage(func() { AllOf(nil) }))
+	assert.Equal(t, "Not: matcher is nil", panicMessage(func() { Not(nil) }))
+}
+
+// panicMessage returns the message of the panic raised by the given function, or an empty string if it did not panic
+func panicMessage(f func()) (msg string) {
+	defer func() {
+		if p := recover(); p != nil {
+			msg = fmt.Sprint(p)
+		}
+	}()
+	f()
+	return ""
+}
+
+func TestRequestMatcher_CombinatorsCanBeNarrowedDown(t *testing.T) {
+	matcher := Not(Request().Method("DELETE")).Path("/foo")
+	assert.True(t, matcher.matches(&http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}))
+	assert.False(t, matcher.matches(&http.Request{Method: "GET", URL: &url.URL{Path: "/bar"}}))
+	assert.False(t, matcher.matches(&http.Request{Method: "DELETE", URL: &url.URL{Path: "/foo"}}))
+	assert.Equal(t, "Not(Method(DELETE)),Path(/foo)", matcher.String())
+}
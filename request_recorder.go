@@ -2,61 +2,258 @@ package mockhttp
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 func newRequestRecorder() *requestRecorder {
 	return &requestRecorder{
-		acceptedRequests:  []recordedRequest{},
-		unmatchedRequests: []recordedRequest{},
+		records: []requestRecord{},
+		changed: make(chan struct{}),
 	}
 }
 
 type requestRecorder struct {
-	mtx               sync.RWMutex
-	acceptedRequests  []recordedRequest
-	unmatchedRequests []recordedRequest
+	mtx     sync.RWMutex
+	records []requestRecord
+	lastID  uint64
+	// changed is closed (and replaced) whenever a new request is recorded, to notify waiters (see recordsAfter)
+	changed chan struct{}
 }
 
-func (r *requestRecorder) AcceptedRequests() []recordedRequest {
-	r.mtx.RLock()
-	defer r.mtx.RUnlock()
-	return copyOf(r.acceptedRequests)
+// requestRecord is a recorded request along with its recording details
+type requestRecord struct {
+	id       uint64
+	request  RecordedRequest
+	accepted bool
+	verified bool
+}
+
+func (r *requestRecorder) AcceptedRequests() []RecordedRequest {
+	return r.filterRequests(true)
 }
 
-func (r *requestRecorder) recordAcceptedRequest(req *http.Request) {
+// recordAcceptedRequest records a request received at the given time and handled by the given endpoint, and returns
+// the ID of the record (see completeRequest)
+func (r *requestRecorder) recordAcceptedRequest(req *http.Request, receivedAt time.Time, endpointID EndpointID, endpoint interface{}) uint64 {
+	request := newRecordedRequest(req, receivedAt)
+	request.EndpointID = endpointID
+	request.endpoint = endpoint
+	return r.record(requestRecord{request: request, accepted: true})
+}
+
+func (r *requestRecorder) UnmatchedRequests() []RecordedRequest {
+	return r.filterRequests(false)
+}
+
+// recordUnmatchedRequest records a request received at the given time which did not match any endpoint, and returns
+// the ID of the record (see completeRequest)
+func (r *requestRecorder) recordUnmatchedRequest(req *http.Request, receivedAt time.Time) uint64 {
+	return r.record(requestRecord{request: newRecordedRequest(req, receivedAt), accepted: false})
+}
+
+// completeRequest sets the handling duration and the response of the recorded request with the given ID, once it was
+// handled
+func (r *requestRecorder) completeRequest(id uint64, response *RecordedResponse) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
-	r.acceptedRequests = append(r.acceptedRequests, newRecordedRequest(req))
+	if record := r.find(id); record != nil {
+		record.request.Duration = time.Since(record.request.ReceivedAt)
+		record.request.Response = response
+	}
 }
 
-func (r *requestRecorder) UnmatchedRequests() []recordedRequest {
-	r.mtx.RLock()
-	defer r.mtx.RUnlock()
-	return copyOf(r.unmatchedRequests)
+// completeResponseBody sets the response body of the recorded request with the given ID, once it was read by the client
+func (r *requestRecorder) completeResponseBody(id uint64, body *bodyRecorder) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if record := r.find(id); record != nil && record.request.Response != nil {
+		// copy, as the previous response may be referenced by requests returned to callers
+		response := *record.request.Response
+		response.Body = body.body
+		response.BodyTruncated = body.truncated
+		response.BodySize = body.size
+		record.request.Response = &response
+	}
+}
+
+// recordResponse returns the given response of a mock client, after it was recorded for the recorded request with the
+// given ID. The response body is recorded (up to the given limit) as it is read.
+func (r *requestRecorder) recordResponse(id uint64, response *http.Response, err error, bodyLimit int) (*http.Response, error) {
+	if err != nil || response == nil {
+		r.completeRequest(id, &RecordedResponse{Error: err, SentAt: time.Now()})
+		return response, err
+	}
+	r.completeRequest(id, &RecordedResponse{
+		StatusCode: response.StatusCode,
+		Header:     response.Header.Clone(),
+		SentAt:     time.Now(),
+	})
+	if response.Body == nil || response.Body == http.NoBody {
+		// nothing to record, and callers may compare the body to http.NoBody
+		return response, nil
+	}
+	response.Body = &recordingBody{
+		ReadCloser:   response.Body,
+		bodyRecorder: bodyRecorder{limit: bodyLimit},
+		onDone: func(body *bodyRecorder) {
+			r.completeResponseBody(id, body)
+		},
+	}
+	return response, nil
+}
+
+// find returns the record with the given ID, or nil if there is no such record (e.g. after the history was cleared).
+// Must be called while holding the lock.
+func (r *requestRecorder) find(id uint64) *requestRecord {
+	i := sort.Search(len(r.records), func(i int) bool {
+		return r.records[i].id >= id
+	})
+	if i < len(r.records) && r.records[i].id == id {
+		return &r.records[i]
+	}
+	return nil
 }
 
-func (r *requestRecorder) recordUnmatchedRequest(req *http.Request) {
+func (r *requestRecorder) ClearHistory() {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
-	r.unmatchedRequests = append(r.unmatchedRequests, newRecordedRequest(req))
+	r.records = []requestRecord{}
 }
 
-func (r *requestRecorder) ClearHistory() {
+func (r *requestRecorder) record(record requestRecord) uint64 {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
-	r.acceptedRequests = []recordedRequest{}
-	r.unmatchedRequests = []recordedRequest{}
+	r.lastID++
+	record.id = r.lastID
+	r.records = append(r.records, record)
+	close(r.changed)
+	r.changed = make(chan struct{})
+	return record.id
+}
+
+// lastRecordID returns the ID of the last recorded request (0 if no request was recorded yet)
+func (r *requestRecorder) lastRecordID() uint64 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.lastID
+}
+
+// recordsAfter returns the records of the requests recorded after the request with the given ID, along with a channel
+// which is closed once another request is recorded
+func (r *requestRecorder) recordsAfter(id uint64) ([]requestRecord, <-chan struct{}) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	start := sort.Search(len(r.records), func(i int) bool {
+		return r.records[i].id > id
+	})
+	res := make([]requestRecord, len(r.records)-start)
+	copy(res, r.records[start:])
+	return res, r.changed
+}
+
+// markVerified marks the records with the given IDs as verified (see verifyNoMoreInteractions)
+func (r *requestRecorder) markVerified(ids ...uint64) {
+	verified := map[uint64]bool{}
+	for _, id := range ids {
+		verified[id] = true
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for i := range r.records {
+		if verified[r.records[i].id] {
+			r.records[i].verified = true
+		}
+	}
+}
+
+// unverified returns all records which were not verified yet, in the order the requests were received
+func (r *requestRecorder) unverified() []requestRecord {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	res := []requestRecord{}
+	for _, record := range r.records {
+		if !record.verified {
+			res = append(res, record)
+		}
+	}
+	return res
+}
+
+// subscribe returns a channel which streams the requests recorded after the call, which match all given matchers. The
+// channel is closed once the given context is done.
+//
+// Requests are streamed from the recorded history, so a slow consumer does not miss requests (unless the history is
+// cleared before they are streamed).
+func (r *requestRecorder) subscribe(ctx context.Context, matchers ...*requestMatcher) <-chan RecordedRequest {
+	ch := make(chan RecordedRequest)
+	lastID := r.lastRecordID()
+	go func() {
+		defer close(ch)
+		for {
+			records, changed := r.recordsAfter(lastID)
+			for _, record := range records {
+				lastID = record.id
+				if !matchesAll(record.request, matchers) {
+					continue
+				}
+				select {
+				case ch <- record.request:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func matchesAll(request RecordedRequest, matchers []*requestMatcher) bool {
+	for _, matcher := range matchers {
+		if !matcher.matches(request.toHttpRequest()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *requestRecorder) filterRequests(accepted bool) []RecordedRequest {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	res := []RecordedRequest{}
+	for _, record := range r.records {
+		if record.accepted == accepted {
+			res = append(res, record.request)
+		}
+	}
+	return res
+}
+
+// timeline returns all records (both accepted and unmatched requests), in the order the requests were received
+func (r *requestRecorder) timeline() []requestRecord {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	res := make([]requestRecord, len(r.records))
+	copy(res, r.records)
+	return res
 }
 
 func (r *requestRecorder) String() string {
-	requests2str := func(requests []recordedRequest) string {
+	requests2str := func(requests []RecordedRequest) string {
 		str := ""
 		for i, req := range requests {
 			str += fmt.Sprintf("  %2d: %s %s\n", i+1, req.Method, req.Path)
@@ -67,34 +264,125 @@ func (r *requestRecorder) String() string {
 		return str
 	}
 
-	r.mtx.RLock()
-	defer r.mtx.RUnlock()
-
-	accepted := requests2str(r.acceptedRequests)
-	unmatched := requests2str(r.unmatchedRequests)
+	// both lists from a single snapshot, so they are consistent with each other while requests are recorded concurrently
+	accepted, unmatched := []RecordedRequest{}, []RecordedRequest{}
+	for _, record := range r.timeline() {
+		if record.accepted {
+			accepted = append(accepted, record.request)
+		} else {
+			unmatched = append(unmatched, record.request)
+		}
+	}
 	return fmt.Sprintf(""+
 		"Accepted:\n%s"+
-		"Unmatched:\n%s", accepted, unmatched)
+		"Unmatched:\n%s", requests2str(accepted), requests2str(unmatched))
 }
 
-type recordedRequest struct {
+func recordIDs(records []requestRecord) []uint64 {
+	ids := make([]uint64, len(records))
+	for i, record := range records {
+		ids[i] = record.id
+	}
+	return ids
+}
+
+// timelineString returns a description of the given records, in the order given
+func timelineString(records []requestRecord) string {
+	b := strings.Builder{}
+	for i, record := range records {
+		query := ""
+		if len(record.request.Query) > 0 {
+			query = fmt.Sprintf("?%s", record.request.Query.Encode())
+		}
+		status := "accepted"
+		if !record.accepted {
+			status = "unmatched"
+		}
+		b.WriteString(fmt.Sprintf("  %2d: %s %s%s (%s)\n", i+1, record.request.Method, record.request.Path, query, status))
+	}
+	return b.String()
+}
+
+// RecordedRequest is a request received by a mock server or client, as recorded by it
+type RecordedRequest struct {
 	Method string
-	Path   string
-	Query  url.Values
-	Header http.Header
-	Body   []byte
+	// Scheme is the URL scheme ("http" or "https")
+	Scheme string
+	// Path is the (decoded) URL path
+	Path string
+	// RawPath is the encoded URL path as received, only set if it differs from the default encoding of Path (see
+	// url.URL.RawPath)
+	RawPath string
+	// RequestURI is the unmodified request target, as sent by the client. Only set for requests received by a server.
+	RequestURI string
+	Query      url.Values
+	Header     http.Header
+	Body       []byte
+	Host       string
+	Proto      string
+	// ContentLength is the content length declared by the request (-1 if unknown)
+	ContentLength int64
+	// RemoteAddr is the network address of the client. Only set for requests received by a server.
+	RemoteAddr string
+	// TLS is the TLS connection state (e.g. server name, negotiated version, peer certificates). Nil for plain HTTP
+	// requests.
+	TLS *tls.ConnectionState
+	// ReceivedAt is the time the request was received, before it was matched against the endpoints
+	ReceivedAt time.Time
+	// Duration is the time it took to handle the request. Zero while the request is still being handled.
+	Duration time.Duration
+	// EndpointID identifies the endpoint which handled the request: for a server, the ID returned when the endpoint was
+	// added (see the server's AddEndpoint), for a client, the 1-based position of the endpoint as given to NewClient.
+	// Zero for unmatched requests.
+	EndpointID EndpointID
+	// endpoint is the endpoint which handled the request, used for describing it
+	endpoint interface{}
+	// Response is the response sent for the request. Nil while the request is still being handled.
+	//
+	// For requests received by a server, the response is recorded once the endpoint returns. Note that a response
+	// which was flushed (or exceeds the server's write buffer) may reach the client before that.
+	//
+	// For requests received by a client, the response body is recorded as the response body is read, so it is set only
+	// once the body is read to its end or closed.
+	Response *RecordedResponse
+}
+
+func newRecordedRequest(r *http.Request, receivedAt time.Time) RecordedRequest {
+	bodyBytes := readRequestBody(r)
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return RecordedRequest{
+		Method:        r.Method,
+		Scheme:        scheme,
+		Path:          r.URL.Path,
+		RawPath:       r.URL.RawPath,
+		RequestURI:    r.RequestURI,
+		Query:         r.URL.Query(),
+		Header:        r.Header,
+		Body:          bodyBytes,
+		Host:          host,
+		Proto:         r.Proto,
+		ContentLength: r.ContentLength,
+		RemoteAddr:    r.RemoteAddr,
+		TLS:           r.TLS,
+		ReceivedAt:    receivedAt,
+	}
 }
 
-func newRecordedRequest(r *http.Request) recordedRequest {
+// readRequestBody reads all bytes of the request body, and restores the body so it can be read again
+func readRequestBody(r *http.Request) []byte {
 	bodyBytes := readAllOrNil(r.Body)
 	r.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
-	return recordedRequest{
-		Method: r.Method,
-		Path:   r.URL.Path,
-		Query:  r.URL.Query(),
-		Header: r.Header,
-		Body:   bodyBytes,
-	}
+	return bodyBytes
 }
 
 func readAllOrNil(r io.Reader) []byte {
@@ -108,27 +396,35 @@ func readAllOrNil(r io.Reader) []byte {
 	return data
 }
 
-func (r recordedRequest) toHttpRequest() *http.Request {
+func (r RecordedRequest) toHttpRequest() *http.Request {
 	httpRequest := http.Request{
 		Method: r.Method,
 		URL: &url.URL{
+			Scheme:   r.Scheme,
+			Host:     r.Host,
 			Path:     r.Path,
+			RawPath:  r.RawPath,
 			RawQuery: r.Query.Encode(),
 		},
-		Header: r.Header,
-		Body:   ioutil.NopCloser(bytes.NewReader(r.Body)),
+		Header:        r.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		Host:          r.Host,
+		Proto:         r.Proto,
+		ContentLength: r.ContentLength,
+		RemoteAddr:    r.RemoteAddr,
+		TLS:           r.TLS,
 	}
 	return &httpRequest
 }
 
-func (r recordedRequest) BodyAsString() string {
+func (r RecordedRequest) BodyAsString() string {
 	if r.Body != nil {
 		return string(r.Body)
 	}
 	return ""
 }
 
-func (r recordedRequest) String() string {
+func (r RecordedRequest) String() string {
 	b := strings.Builder{}
 	query := ""
 	if len(r.Query) > 0 {
@@ -140,13 +436,3 @@ func (r recordedRequest) String() string {
 	b.WriteRune('\n')
 	return b.String()
 }
-
-func copyOf(orig []recordedRequest) []recordedRequest {
-	if orig == nil {
-		return nil
-	}
-
-	res := make([]recordedRequest, len(orig))
-	copy(res, orig)
-	return res
-}
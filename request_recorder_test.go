@@ -1,12 +1,14 @@
 package mockhttp
 
 import (
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRecordedRequest(t *testing.T) {
@@ -45,7 +47,7 @@ hello
 			require.NoError(t, err)
 			req.Header = tt.header
 
-			recReq := newRecordedRequest(req)
+			recReq := newRecordedRequest(req, time.Now())
 
 			assert.Equal(t, req.Method, recReq.Method, "unexpected method")
 			assert.Equal(t, req.URL.Path, recReq.Path, "unexpected url path")
@@ -53,6 +55,9 @@ hello
 			assert.Equal(t, tt.body, recReq.BodyAsString(), "unexpected body as string")
 			assert.Equal(t, req.Header, recReq.Header, "unexpected headers")
 			assert.Equal(t, req.URL.Query(), recReq.Query, "unexpected query params")
+			assert.Equal(t, req.URL.Host, recReq.Host, "unexpected host")
+			assert.Equal(t, req.Proto, recReq.Proto, "unexpected protocol")
+			assert.Equal(t, int64(len(tt.body)), recReq.ContentLength, "unexpected content length")
 			assert.Equal(t, tt.expected, strings.Replace(recReq.String(), "\r", "", -1), "unexpected recorded request as string")
 
 			newReq := recReq.toHttpRequest()
@@ -73,19 +78,19 @@ func TestRequestRecorder(t *testing.T) {
 
 	req, err := http.NewRequest("GET", "http://host/foo/bar", nil)
 	require.NoError(t, err)
-	recorder.recordAcceptedRequest(req)
+	recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
 	assert.Equal(t, 1, len(recorder.AcceptedRequests()), "unexpected number of accepted requests")
 	assert.Equal(t, 0, len(recorder.UnmatchedRequests()), "unexpected number of unmatched requests")
 
 	req, err = http.NewRequest("DELETE", "http://host/bar", nil)
 	require.NoError(t, err)
-	recorder.recordUnmatchedRequest(req)
+	recorder.recordUnmatchedRequest(req, time.Now())
 	assert.Equal(t, 1, len(recorder.AcceptedRequests()), "unexpected number of accepted requests")
 	assert.Equal(t, 1, len(recorder.UnmatchedRequests()), "unexpected number of unmatched requests")
 
 	req, err = http.NewRequest("POST", "http://host/foo/baz", strings.NewReader("goodbye"))
 	require.NoError(t, err)
-	recorder.recordAcceptedRequest(req)
+	recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
 	require.Equal(t, 2, len(recorder.AcceptedRequests()), "unexpected number of accepted requests")
 	require.Equal(t, 1, len(recorder.UnmatchedRequests()), "unexpected number of unmatched requests")
 	assert.Equal(t, "GET", recorder.AcceptedRequests()[0].Method, "unexpected method for 1st accepted request")
@@ -96,7 +101,99 @@ func TestRequestRecorder(t *testing.T) {
 	assert.Equal(t, "/bar", recorder.UnmatchedRequests()[0].Path, "unexpected path for 1st unmatched request")
 	assert.Equal(t, "Accepted:\n   1: GET /foo/bar\n   2: POST /foo/baz\nUnmatched:\n   1: DELETE /bar\n", recorder.String(), "unexpected recorder as string")
 
+	timeline := recorder.timeline()
+	require.Equal(t, 3, len(timeline), "unexpected number of requests in timeline")
+	assert.Equal(t, "/foo/bar", timeline[0].request.Path, "unexpected path for 1st request in timeline")
+	assert.True(t, timeline[0].accepted, "1st request in timeline was expected to be accepted")
+	assert.Equal(t, "/bar", timeline[1].request.Path, "unexpected path for 2nd request in timeline")
+	assert.False(t, timeline[1].accepted, "2nd request in timeline was expected to be unmatched")
+	assert.Equal(t, "/foo/baz", timeline[2].request.Path, "unexpected path for 3rd request in timeline")
+	assert.True(t, timeline[2].accepted, "3rd request in timeline was expected to be accepted")
+
 	recorder.ClearHistory()
+	assert.Equal(t, 0, len(recorder.timeline()), "unexpected number of requests in timeline after history cleanup")
 	assert.Equal(t, 0, len(recorder.AcceptedRequests()), "unexpected number of accepted requests after history cleanup")
 	assert.Equal(t, 0, len(recorder.UnmatchedRequests()), "unexpected number of unmatched requests after history cleanup")
 }
+
+func TestRequestRecorder_RecordsAfter(t *testing.T) {
+	recorder := newRequestRecorder()
+	assert.Equal(t, uint64(0), recorder.lastRecordID(), "unexpected last record ID of empty recorder")
+	records, changed := recorder.recordsAfter(0)
+	assert.Empty(t, records, "unexpected records of empty recorder")
+
+	req, err := http.NewRequest("GET", "http://host/foo", nil)
+	require.NoError(t, err)
+	recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
+	select {
+	case <-changed:
+	default:
+		assert.Fail(t, "expected change to be notified after recording a request")
+	}
+
+	req, err = http.NewRequest("GET", "http://host/bar", nil)
+	require.NoError(t, err)
+	recorder.recordUnmatchedRequest(req, time.Now())
+	lastID := recorder.lastRecordID()
+	assert.Equal(t, uint64(2), lastID, "unexpected last record ID")
+
+	records, _ = recorder.recordsAfter(0)
+	require.Equal(t, 2, len(records), "unexpected number of records")
+	assert.Equal(t, "/foo", records[0].request.Path, "unexpected path of 1st record")
+	assert.Equal(t, "/bar", records[1].request.Path, "unexpected path of 2nd record")
+	records, _ = recorder.recordsAfter(1)
+	require.Equal(t, 1, len(records), "unexpected number of records after 1st record")
+	assert.Equal(t, "/bar", records[0].request.Path, "unexpected path of record after 1st record")
+	records, changed = recorder.recordsAfter(lastID)
+	assert.Empty(t, records, "unexpected records after last record")
+	select {
+	case <-changed:
+		assert.Fail(t, "unexpected change notified before recording another request")
+	default:
+	}
+
+	recorder.ClearHistory()
+	recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
+	records, _ = recorder.recordsAfter(lastID)
+	require.Equal(t, 1, len(records), "unexpected number of records after history cleanup")
+	assert.Equal(t, lastID+1, records[0].id, "record IDs are expected to keep increasing after history cleanup")
+}
+
+func TestRequestRecorder_Subscribe(t *testing.T) {
+	recorder := newRequestRecorder()
+	record := func(method, url string) {
+		req, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
+	}
+	record("GET", "http://host/before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	all := recorder.subscribe(ctx)
+	filtered := recorder.subscribe(ctx, Request().Method("GET"), Request().PathTemplate("/items/{id}"))
+	record("GET", "http://host/items/1")
+	record("POST", "http://host/items/2")
+	record("GET", "http://host/other")
+	record("GET", "http://host/items/3")
+
+	receive := func(ch <-chan RecordedRequest) string {
+		select {
+		case req := <-ch:
+			return req.Method + " " + req.Path
+		case <-time.After(time.Second):
+			return "timeout"
+		}
+	}
+	assert.Equal(t, "GET /items/1", receive(all), "unexpected 1st streamed request")
+	assert.Equal(t, "POST /items/2", receive(all), "unexpected 2nd streamed request")
+	assert.Equal(t, "GET /other", receive(all), "unexpected 3rd streamed request")
+	assert.Equal(t, "GET /items/3", receive(all), "unexpected 4th streamed request")
+	assert.Equal(t, "GET /items/1", receive(filtered), "unexpected 1st streamed filtered request")
+	assert.Equal(t, "GET /items/3", receive(filtered), "unexpected 2nd streamed filtered request")
+
+	cancel()
+	for range all {
+	}
+	for range filtered {
+	}
+}
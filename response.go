@@ -1,15 +1,25 @@
 package mockhttp
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"strings"
+	"text/template"
 	"time"
 )
 
 type response struct {
-	statusCode int
-	body       []byte
-	header     http.Header
-	delay      time.Duration
+	statusCode       int
+	body             []byte
+	header           http.Header
+	delay            time.Duration
+	expandPathParams bool
+	bodyTemplate     *template.Template
+	headerTemplates  map[string]*template.Template
+	fault            *fault
+	bodyReadErr      error
+	bodyReadErrAfter int
 }
 
 // Response creates a new response definition.
@@ -22,9 +32,10 @@ type response struct {
 //   - No delay
 func Response() *response {
 	return &response{
-		statusCode: http.StatusOK,
-		body:       []byte{},
-		header:     http.Header{},
+		statusCode:      http.StatusOK,
+		body:            []byte{},
+		header:          http.Header{},
+		headerTemplates: map[string]*template.Template{},
 	}
 }
 
@@ -37,17 +48,32 @@ func (r *response) StatusCode(statusCode int) *response {
 // Body sets the body bytes to respond with
 func (r *response) Body(body []byte) *response {
 	r.body = body
+	r.bodyTemplate = nil
 	return r
 }
 
 // BodyString sets the body (as string) to respond with
 func (r *response) BodyString(body string) *response {
 	r.body = []byte(body)
+	r.bodyTemplate = nil
+	return r
+}
+
+// BodyTemplate sets a body template to respond with, rendered per request using text/template. Panics if the template
+// cannot be parsed.
+//
+// The template can reference the incoming request: .Method, .Path, .Query, .Header, .Body (as string), .JSON (the body
+// parsed as JSON) and .PathParams (captured by PathTemplate). Helper functions: uuid, now, timestamp, base64Encode,
+// base64Decode and toJSON. For example:
+//   Response().BodyTemplate(`{"id": "{{uuid}}", "name": {{toJSON .JSON.name}}, "repo": "{{.PathParams.repo}}"}`)
+func (r *response) BodyTemplate(tmpl string) *response {
+	r.bodyTemplate = mustParseTemplate("body", tmpl)
 	return r
 }
 
 // Header sets header key-values pair to respond with
 func (r *response) Header(key, value string, other ...string) *response {
+	delete(r.headerTemplates, http.CanonicalHeaderKey(key))
 	r.header.Set(key, value)
 	for _, v := range other {
 		r.header.Add(key, v)
@@ -55,8 +81,131 @@ func (r *response) Header(key, value string, other ...string) *response {
 	return r
 }
 
-// Delay sets a delay, after receiving a request, before sending the response
+// HeaderTemplate sets a header whose value is rendered per request using text/template, the same way as BodyTemplate.
+// Panics if the template cannot be parsed.
+//
+// For example:
+//   Response().HeaderTemplate("X-Request-Id", `{{.Header.Get "X-Request-Id"}}`)
+func (r *response) HeaderTemplate(key, tmpl string) *response {
+	key = http.CanonicalHeaderKey(key)
+	r.header.Del(key)
+	r.headerTemplates[key] = mustParseTemplate(key, tmpl)
+	return r
+}
+
+// Delay sets a delay, after receiving a request, before sending the response.
+//
+// Waiting is aborted once the request context is done, e.g. when the client disconnects or the request deadline
+// passes. In that case, a server endpoint sends no response (and records the context error instead, see
+// RecordedResponse.Error), and a client endpoint returns the context error, as a real transport does.
 func (r *response) Delay(delay time.Duration) *response {
 	r.delay = delay
 	return r
 }
+
+// wait waits for the delay of the response (if set). Returns the error of the given context if it is done before the
+// delay passes.
+func (r *response) wait(ctx context.Context) error {
+	if r.delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(r.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fault sets a transport-level fault to simulate instead of sending a proper response, e.g. ResetConnection() or
+// TruncateBody(10). The fault is injected on the (hijacked) connection of the request, after the delay (if set), using
+// the status code, headers and body of this response where relevant.
+//
+// Supported by server endpoints only. Client endpoints return an error instead.
+//
+// For example:
+//   NewServerEndpoint().
+//   	When(Request().GET("/download")).
+//   	Respond(Response().BodyString("some large content").Fault(TruncateBody(4)))
+func (r *response) Fault(f *fault) *response {
+	r.fault = f
+	return r
+}
+
+// BodyReadError sets reading the response body to fail with the given error, after reading the given number of body
+// bytes. If the error is nil, io.ErrUnexpectedEOF is used, the same error a real transport returns when the connection
+// is closed before the whole body is read.
+//
+// On server endpoints, the body is truncated using the TruncateBody fault instead, so the client fails with
+// io.ErrUnexpectedEOF regardless of the given error.
+func (r *response) BodyReadError(afterBytes int, err error) *response {
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	r.bodyReadErr = err
+	r.bodyReadErrAfter = afterBytes
+	return r
+}
+
+// ExpandPathParams sets the response to expand path parameter placeholders in the body and header values. Each
+// placeholder {name} is replaced with the value of the path parameter captured by the PathTemplate request matcher of
+// the endpoint. Placeholders of unknown path parameters are left as is.
+//
+// For example:
+//   NewServerEndpoint().
+//   	When(Request().PathTemplate("/repos/{repo}/items/{id}")).
+//   	Respond(Response().BodyString(`{"repo": "{repo}", "id": "{id}"}`).ExpandPathParams())
+func (r *response) ExpandPathParams() *response {
+	r.expandPathParams = true
+	return r
+}
+
+// render returns the header and body to respond with for the given request
+func (r *response) render(request *http.Request) (http.Header, []byte, error) {
+	header, body := r.expand(request)
+	if r.bodyTemplate == nil && len(r.headerTemplates) == 0 {
+		return header, body, nil
+	}
+
+	data := newTemplateData(request)
+	if r.bodyTemplate != nil {
+		rendered, err := executeTemplate(r.bodyTemplate, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = []byte(rendered)
+	}
+	if len(r.headerTemplates) > 0 {
+		header = header.Clone()
+		for key, tmpl := range r.headerTemplates {
+			rendered, err := executeTemplate(tmpl, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			header.Set(key, rendered)
+		}
+	}
+	return header, body, nil
+}
+
+// expand returns the header and body to respond with, after expanding path parameter placeholders (if needed)
+func (r *response) expand(request *http.Request) (http.Header, []byte) {
+	if !r.expandPathParams {
+		return r.header, r.body
+	}
+	params := PathParams(request)
+	oldNew := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		oldNew = append(oldNew, "{"+name+"}", value)
+	}
+	replacer := strings.NewReplacer(oldNew...)
+	header := make(http.Header, len(r.header))
+	for name, values := range r.header {
+		for _, v := range values {
+			header.Add(name, replacer.Replace(v))
+		}
+	}
+	return header, []byte(replacer.Replace(string(r.body)))
+}
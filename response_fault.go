@@ -0,0 +1,173 @@
+package mockhttp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// fault is a transport-level fault, simulated by a mock server on the connection of a request, instead of sending a
+// proper response (see the response's Fault builder function)
+type fault struct {
+	description string
+	inject      func(conn net.Conn, w *bufio.Writer, statusCode int, header http.Header, body []byte) error
+}
+
+// CloseConnection is a fault which closes the connection before writing anything
+func CloseConnection() *fault {
+	return &fault{
+		description: "CloseConnection",
+		inject: func(conn net.Conn, w *bufio.Writer, statusCode int, header http.Header, body []byte) error {
+			return nil
+		},
+	}
+}
+
+// ResetConnection is a fault which resets the connection (sends RST) before writing anything
+func ResetConnection() *fault {
+	return &fault{
+		description: "ResetConnection",
+		inject: func(conn net.Conn, w *bufio.Writer, statusCode int, header http.Header, body []byte) error {
+			if inMemoryConn, ok := conn.(interface{ resetOnClose() }); ok {
+				// a connection of a server's in-memory transport
+				inMemoryConn.resetOnClose()
+				return nil
+			}
+			if netConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+				// the underlying connection of a TLS connection
+				conn = netConn.NetConn()
+			}
+			tcpConn, ok := conn.(*net.TCPConn)
+			if !ok {
+				return fmt.Errorf("not a TCP connection: %T", conn)
+			}
+			// closing with linger 0 discards unsent data and sends RST instead of FIN
+			return tcpConn.SetLinger(0)
+		},
+	}
+}
+
+// TruncateBody is a fault which sends the status line and headers of the response, with a Content-Length of the full
+// body, then sends only the given number of body bytes and closes the connection
+func TruncateBody(afterBytes int) *fault {
+	return &fault{
+		description: fmt.Sprintf("TruncateBody(%d)", afterBytes),
+		inject: func(conn net.Conn, w *bufio.Writer, statusCode int, header http.Header, body []byte) error {
+			header = header.Clone()
+			header.Set("Content-Length", strconv.Itoa(len(body)))
+			header.Del("Transfer-Encoding")
+			if err := writeStatusAndHeader(w, statusCode, header); err != nil {
+				return err
+			}
+			_, err := w.Write(truncate(body, afterBytes))
+			return err
+		},
+	}
+}
+
+// TruncateChunkedBody is a fault which sends the status line and headers of the response with chunked transfer
+// encoding, then sends the body as a single chunk, but stops after the given number of body bytes (in the middle of the
+// chunk) and closes the connection
+func TruncateChunkedBody(afterBytes int) *fault {
+	return &fault{
+		description: fmt.Sprintf("TruncateChunkedBody(%d)", afterBytes),
+		inject: func(conn net.Conn, w *bufio.Writer, statusCode int, header http.Header, body []byte) error {
+			header = header.Clone()
+			header.Del("Content-Length")
+			header.Set("Transfer-Encoding", "chunked")
+			if err := writeStatusAndHeader(w, statusCode, header); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%x\r\n", len(body)); err != nil {
+				return err
+			}
+			_, err := w.Write(truncate(body, afterBytes))
+			return err
+		},
+	}
+}
+
+// MalformedStatusLine is a fault which sends a malformed status line (followed by the headers and body of the response)
+func MalformedStatusLine() *fault {
+	return &fault{
+		description: "MalformedStatusLine",
+		inject: func(conn net.Conn, w *bufio.Writer, statusCode int, header http.Header, body []byte) error {
+			if _, err := fmt.Fprintf(w, "HTTP/1.1 OK %d\r\n", statusCode); err != nil {
+				return err
+			}
+			header = header.Clone()
+			header.Set("Content-Length", strconv.Itoa(len(body)))
+			if err := writeHeader(w, header); err != nil {
+				return err
+			}
+			_, err := w.Write(body)
+			return err
+		},
+	}
+}
+
+// RawBytes is a fault which sends the given bytes as is, instead of the response, and closes the connection
+func RawBytes(data []byte) *fault {
+	return &fault{
+		description: fmt.Sprintf("RawBytes(%d bytes)", len(data)),
+		inject: func(conn net.Conn, w *bufio.Writer, statusCode int, header http.Header, body []byte) error {
+			_, err := w.Write(data)
+			return err
+		},
+	}
+}
+
+func (f *fault) String() string {
+	return f.description
+}
+
+// injectFault hijacks the connection of the given response writer, injects the fault and closes the connection.
+// Responds with status 500 if the connection cannot be hijacked.
+func injectFault(response http.ResponseWriter, f *fault, statusCode int, header http.Header, body []byte) {
+	hijacker, ok := response.(http.Hijacker)
+	if !ok {
+		http.Error(response, fmt.Sprintf("could not inject fault %s: connection cannot be hijacked", f), http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(response, fmt.Sprintf("could not inject fault %s: %v", f, err), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	if err := f.inject(conn, rw.Writer, statusCode, header, body); err != nil {
+		fmt.Printf("Mock server could not inject fault %s: %v\n", f, err)
+		return
+	}
+	if err := rw.Flush(); err != nil {
+		fmt.Printf("Mock server could not inject fault %s: %v\n", f, err)
+	}
+}
+
+func writeStatusAndHeader(w *bufio.Writer, statusCode int, header http.Header) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode)); err != nil {
+		return err
+	}
+	return writeHeader(w, header)
+}
+
+func writeHeader(w *bufio.Writer, header http.Header) error {
+	if err := header.Write(w); err != nil {
+		return err
+	}
+	_, err := w.WriteString("\r\n")
+	return err
+}
+
+// truncate returns the first n bytes of the given data (at most all of it)
+func truncate(data []byte, n int) []byte {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(data) {
+		n = len(data)
+	}
+	return data[:n]
+}
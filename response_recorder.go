@@ -0,0 +1,181 @@
+package mockhttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultResponseBodyLimit is the default maximum number of response body bytes recorded for each request
+const DefaultResponseBodyLimit = 1024 * 1024
+
+// RecordedResponse is the response sent by a mock server or returned by a mock client for a recorded request
+type RecordedResponse struct {
+	StatusCode int
+	Header     http.Header
+	// Body is the response body, up to the response body limit
+	Body []byte
+	// BodyTruncated is true if the response body exceeded the response body limit, so Body holds only its beginning
+	BodyTruncated bool
+	// BodySize is the total size of the response body, in bytes
+	BodySize int64
+	// SentAt is the time the response status and header were sent (server), or the response was returned (client)
+	SentAt time.Time
+	// Error is the error returned instead of a response (client), or the error of the request context when it was done
+	// before any response was sent, e.g. when the client disconnected during a delay (server). StatusCode is zero when
+	// set.
+	Error error
+}
+
+func (r *RecordedResponse) BodyAsString() string {
+	if r.Body != nil {
+		return string(r.Body)
+	}
+	return ""
+}
+
+func (r *RecordedResponse) String() string {
+	if r.Error != nil {
+		return fmt.Sprintf("error: %v", r.Error)
+	}
+	return fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode))
+}
+
+// bodyRecorder records up to a limit of body bytes
+type bodyRecorder struct {
+	limit     int
+	body      []byte
+	size      int64
+	truncated bool
+}
+
+func (b *bodyRecorder) write(data []byte) {
+	b.size += int64(len(data))
+	if b.limit >= 0 && len(b.body)+len(data) > b.limit {
+		data = data[:b.limit-len(b.body)]
+		b.truncated = true
+	}
+	b.body = append(b.body, data...)
+}
+
+// recordingResponseWriter wraps the response writer of a mock server, to record the response sent
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	bodyRecorder
+	statusCode int
+	header     http.Header
+	sentAt     time.Time
+	hijacked   bool
+}
+
+func newRecordingResponseWriter(w http.ResponseWriter, bodyLimit int) *recordingResponseWriter {
+	return &recordingResponseWriter{
+		ResponseWriter: w,
+		bodyRecorder:   bodyRecorder{limit: bodyLimit},
+	}
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+		w.header = w.Header().Clone()
+		w.sentAt = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.write(data[:n])
+	return n, err
+}
+
+func (w *recordingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.statusCode == 0 {
+			w.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+func (w *recordingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		conn, rw, err := hijacker.Hijack()
+		w.hijacked = err == nil
+		return conn, rw, err
+	}
+	return nil, nil, fmt.Errorf("response writer does not support hijacking")
+}
+
+// Push forwards HTTP/2 server push to the wrapped response writer. Returns http.ErrNotSupported if the wrapped response
+// writer does not support it (e.g. HTTP/1.x connections).
+func (w *recordingResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped response writer, so http.ResponseController can reach features of the server's response
+// writer (e.g. SetWriteDeadline). Writing to the wrapped response writer directly bypasses recording.
+func (w *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// recordedResponse returns the response recorded so far. A handler which did not write anything implicitly responds
+// with status 200, unless the given request context is done, so no response can be sent (the context error is recorded
+// instead). Nothing is recorded for a hijacked connection, besides what was written before it was hijacked.
+func (w *recordingResponseWriter) recordedResponse(ctx context.Context) *RecordedResponse {
+	if w.statusCode == 0 && !w.hijacked {
+		if err := ctx.Err(); err != nil {
+			return &RecordedResponse{Error: err, SentAt: time.Now()}
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return &RecordedResponse{
+		StatusCode:    w.statusCode,
+		Header:        w.header,
+		Body:          w.body,
+		BodyTruncated: w.truncated,
+		BodySize:      w.size,
+		SentAt:        w.sentAt,
+	}
+}
+
+// recordingBody wraps the body of a response returned by a mock client, to record the body as it is read. The recorded
+// response is updated once the body is read to its end or closed.
+type recordingBody struct {
+	io.ReadCloser
+	bodyRecorder
+	onDone func(*bodyRecorder)
+	once   sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.write(p[:n])
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) done() {
+	b.once.Do(func() {
+		b.onDone(&b.bodyRecorder)
+	})
+}
@@ -0,0 +1,139 @@
+package mockhttp
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyRecorder(t *testing.T) {
+	tests := []struct {
+		limit     int
+		writes    []string
+		body      string
+		truncated bool
+	}{
+		{limit: 10, writes: []string{"hello", "world"}, body: "helloworld"},
+		{limit: 7, writes: []string{"hello", "world"}, body: "hellowo", truncated: true},
+		{limit: 3, writes: []string{"hello", "world"}, body: "hel", truncated: true},
+		{limit: 0, writes: []string{"hello", "world"}, body: "", truncated: true},
+		{limit: -1, writes: []string{"hello", "world"}, body: "helloworld"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.writes, ","), func(t *testing.T) {
+			b := bodyRecorder{limit: tt.limit}
+			for _, w := range tt.writes {
+				b.write([]byte(w))
+			}
+			assert.Equal(t, tt.body, string(b.body), "unexpected recorded body")
+			assert.Equal(t, tt.truncated, b.truncated, "unexpected truncation")
+			assert.Equal(t, int64(10), b.size, "unexpected body size")
+		})
+	}
+}
+
+func TestRecordingResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newRecordingResponseWriter(rec, 4)
+	w.Header().Set("X-Foo", "foo")
+	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("X-Foo", "changed after header was sent")
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	w.Flush()
+
+	response := w.recordedResponse(context.Background())
+	assert.Equal(t, http.StatusCreated, response.StatusCode, "unexpected recorded status code")
+	assert.Equal(t, "foo", response.Header.Get("X-Foo"), "unexpected recorded header")
+	assert.Equal(t, "hell", response.BodyAsString(), "unexpected recorded body")
+	assert.True(t, response.BodyTruncated, "expected recorded body to be truncated")
+	assert.Equal(t, int64(5), response.BodySize, "unexpected recorded body size")
+	assert.False(t, response.SentAt.IsZero(), "expected time the response was sent to be set")
+	assert.Equal(t, "201 Created", response.String(), "unexpected recorded response as string")
+	assert.Equal(t, "hello", rec.Body.String(), "expected full body to be written")
+	assert.True(t, rec.Flushed, "expected response to be flushed")
+
+	w = newRecordingResponseWriter(httptest.NewRecorder(), 4)
+	assert.Equal(t, http.StatusOK, w.recordedResponse(context.Background()).StatusCode, "expected implicit status code to be recorded")
+	_, _, err = w.Hijack()
+	assert.Error(t, err, "expected hijacking to fail for a response writer which does not support it")
+}
+
+func TestRecordingResponseWriter_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	response := newRecordingResponseWriter(rec, -1).recordedResponse(ctx)
+	assert.Equal(t, 0, response.StatusCode, "expected no status code to be recorded when no response was sent")
+	assert.Equal(t, context.Canceled, response.Error, "expected the context error to be recorded")
+	assert.Equal(t, 0, rec.Body.Len(), "expected nothing to be written")
+
+	w := newRecordingResponseWriter(httptest.NewRecorder(), -1)
+	w.WriteHeader(http.StatusAccepted)
+	response = w.recordedResponse(ctx)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "expected the sent status code to be recorded")
+	assert.NoError(t, response.Error, "expected no error once a response was sent")
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestRecordingResponseWriter_Push(t *testing.T) {
+	pusher := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	assert.NoError(t, newRecordingResponseWriter(pusher, -1).Push("/style.css", nil))
+	assert.Equal(t, []string{"/style.css"}, pusher.pushed, "expected push to be forwarded")
+
+	err := newRecordingResponseWriter(httptest.NewRecorder(), -1).Push("/style.css", nil)
+	assert.Equal(t, http.ErrNotSupported, err, "expected push not to be supported")
+}
+
+func TestRequestRecorder_RecordResponse(t *testing.T) {
+	recorder := newRequestRecorder()
+	req, err := http.NewRequest("GET", "http://host/foo", nil)
+	require.NoError(t, err)
+
+	id := recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
+	response, err := recorder.recordResponse(id, &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"X-Foo": {"foo"}},
+		Body:       ioutil.NopCloser(strings.NewReader("hello")),
+	}, nil, 3)
+	require.NoError(t, err)
+	recorded := recorder.AcceptedRequests()[0].Response
+	require.NotNil(t, recorded, "expected response to be recorded")
+	assert.Equal(t, http.StatusOK, recorded.StatusCode, "unexpected recorded status code")
+	assert.Equal(t, "foo", recorded.Header.Get("X-Foo"), "unexpected recorded header")
+	assert.Nil(t, recorded.Body, "expected body not to be recorded before it is read")
+
+	body, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body), "unexpected response body")
+	assert.Nil(t, recorded.Body, "expected previously returned recorded response not to change")
+	recorded = recorder.AcceptedRequests()[0].Response
+	assert.Equal(t, "hel", recorded.BodyAsString(), "unexpected recorded body")
+	assert.True(t, recorded.BodyTruncated, "expected recorded body to be truncated")
+	assert.Equal(t, int64(5), recorded.BodySize, "unexpected recorded body size")
+
+	id = recorder.recordUnmatchedRequest(req, time.Now())
+	expectedErr := errors.New("dummy error")
+	_, err = recorder.recordResponse(id, nil, expectedErr, 3)
+	assert.Equal(t, expectedErr, err, "unexpected error")
+	recorded = recorder.UnmatchedRequests()[0].Response
+	require.NotNil(t, recorded, "expected error to be recorded")
+	assert.Equal(t, expectedErr, recorded.Error, "unexpected recorded error")
+	assert.Equal(t, "error: dummy error", recorded.String(), "unexpected recorded response as string")
+}
@@ -0,0 +1,71 @@
+package mockhttp
+
+import (
+	"sync"
+)
+
+// responseSequence selects the response of an endpoint for each call. Safe for concurrent use.
+//
+// The responses are used in order, one per call. Once all are used, either the last response repeats or the sequence
+// starts over (cycle). Responses set for specific calls (nth) take precedence over the sequence.
+type responseSequence struct {
+	mtx       sync.Mutex
+	calls     int
+	responses []*response
+	cycle     bool
+	nth       map[int]*response
+}
+
+func newResponseSequence(responses ...*response) responseSequence {
+	return responseSequence{
+		responses: responses,
+		nth:       map[int]*response{},
+	}
+}
+
+func (s *responseSequence) set(cycle bool, responses ...*response) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.responses = responses
+	s.cycle = cycle
+}
+
+func (s *responseSequence) setNth(n int, r *response) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.nth[n] = r
+}
+
+// next counts a new call and returns the response for it. Returns nil if no response is defined for this call.
+func (s *responseSequence) next() *response {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.calls++
+	if r, ok := s.nth[s.calls]; ok {
+		return r
+	}
+	if len(s.responses) == 0 {
+		return nil
+	}
+	index := s.calls - 1
+	if s.cycle {
+		index = index % len(s.responses)
+	} else if index >= len(s.responses) {
+		index = len(s.responses) - 1
+	}
+	return s.responses[index]
+}
+
+// callCount returns the number of calls so far
+func (s *responseSequence) callCount() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.calls
+}
+
+func defaultResponseIfEmpty(responses []*response) []*response {
+	if len(responses) == 0 {
+		return []*response{Response()}
+	}
+	return responses
+}
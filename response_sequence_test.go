@@ -0,0 +1,70 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestResponseSequence(t *testing.T) {
+	r1, r2, r3, nth := Response(), Response(), Response(), Response()
+	tests := []struct {
+		name  string
+		cycle bool
+		want  []*response
+	}{
+		{name: "last response repeats", cycle: false, want: []*response{r1, r2, r3, r3, r3}},
+		{name: "cycle", cycle: true, want: []*response{r1, r2, r3, r1, r2}},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			sequence := newResponseSequence()
+			sequence.set(testCase.cycle, r1, r2, r3)
+			for i, want := range testCase.want {
+				assert.Samef(t, want, sequence.next(), "unexpected response for call #%d", i+1)
+			}
+		})
+	}
+
+	t.Run("nth response overrides the sequence", func(t *testing.T) {
+		sequence := newResponseSequence(r1, r2, r3)
+		sequence.setNth(2, nth)
+		sequence.setNth(5, nth)
+		for i, want := range []*response{r1, nth, r3, r3, nth, r3} {
+			assert.Samef(t, want, sequence.next(), "unexpected response for call #%d", i+1)
+		}
+	})
+
+	t.Run("no responses", func(t *testing.T) {
+		sequence := newResponseSequence()
+		sequence.setNth(2, nth)
+		assert.Nil(t, sequence.next(), "unexpected response for call #1")
+		assert.Same(t, nth, sequence.next(), "unexpected response for call #2")
+		assert.Nil(t, sequence.next(), "unexpected response for call #3")
+	})
+}
+
+func TestResponseSequence_Concurrent(t *testing.T) {
+	const calls = 100
+	responses := make([]*response, calls)
+	for i := range responses {
+		responses[i] = Response()
+	}
+	sequence := newResponseSequence(responses...)
+
+	mtx := sync.Mutex{}
+	used := map[*response]int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := sequence.next()
+			mtx.Lock()
+			defer mtx.Unlock()
+			used[r]++
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, calls, len(used), "expected each response to be used exactly once")
+}
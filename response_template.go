@@ -0,0 +1,98 @@
+package mockhttp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// templateData is the data available to response templates, built from the incoming request
+type templateData struct {
+	// Method is the request method (e.g. "GET")
+	Method string
+	// Path is the request URL path
+	Path string
+	// Query is the request query parameters, e.g. {{.Query.Get "id"}}
+	Query url.Values
+	// Header is the request header, e.g. {{.Header.Get "X-Request-Id"}}
+	Header http.Header
+	// Body is the request body as string
+	Body string
+	// JSON is the request body parsed as JSON, e.g. {{.JSON.items}}. Nil if the body is not a valid JSON document.
+	JSON interface{}
+	// PathParams is the path parameters captured by the endpoint's PathTemplate request matcher, e.g. {{.PathParams.id}}
+	PathParams map[string]string
+}
+
+func newTemplateData(request *http.Request) templateData {
+	body := readRequestBody(request)
+	data := templateData{
+		Method:     request.Method,
+		Header:     request.Header,
+		Body:       string(body),
+		PathParams: PathParams(request),
+	}
+	if data.Header == nil {
+		data.Header = http.Header{}
+	}
+	if request.URL != nil {
+		data.Path = request.URL.Path
+		data.Query = request.URL.Query()
+	} else {
+		data.Query = url.Values{}
+	}
+	if jsonBody, err := parseJSON(body); err == nil {
+		data.JSON = jsonBody
+	}
+	return data
+}
+
+// templateFuncs are the helper functions available to response templates:
+//   uuid          - a new random UUID (version 4)
+//   now           - the current time (time.Time), e.g. {{now.Unix}}
+//   timestamp     - the current time formatted as RFC3339
+//   base64Encode  - encodes a string using standard base64 encoding
+//   base64Decode  - decodes a standard base64 encoded string
+//   toJSON        - marshals a value to JSON, e.g. {{toJSON .JSON.items}}
+var templateFuncs = template.FuncMap{
+	"uuid":         newUUID,
+	"now":          time.Now,
+	"timestamp":    func() string { return time.Now().Format(time.RFC3339) },
+	"base64Encode": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"base64Decode": func(s string) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(s)
+		return string(data), err
+	},
+	"toJSON": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func mustParseTemplate(name, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(templateFuncs).Parse(text))
+}
+
+func executeTemplate(tmpl *template.Template, data templateData) (string, error) {
+	b := bytes.Buffer{}
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func newUUID() string {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		panic(fmt.Errorf("could not generate random UUID: %v", err))
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
@@ -0,0 +1,81 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestResponse_BodyTemplate(t *testing.T) {
+	request, err := http.NewRequest("POST", "http://host/repos/foo/items?q=bar", strings.NewReader(`{"name": "baz", "tags": ["a", "b"]}`))
+	require.NoError(t, err)
+	request.Header.Set("X-Request-Id", "req-1")
+	request = withPathParams(request, map[string]string{"repo": "foo"})
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{tmpl: `{{.Method}} {{.Path}}`, want: "POST /repos/foo/items"},
+		{tmpl: `{{.Query.Get "q"}}`, want: "bar"},
+		{tmpl: `{{.Header.Get "X-Request-Id"}}`, want: "req-1"},
+		{tmpl: `{{.Body}}`, want: `{"name": "baz", "tags": ["a", "b"]}`},
+		{tmpl: `{{.JSON.name}} {{toJSON .JSON.tags}} {{index .JSON.tags 1}}`, want: `baz ["a","b"] b`},
+		{tmpl: `{{.PathParams.repo}}`, want: "foo"},
+		{tmpl: `{{base64Encode "hello"}} {{base64Decode "aGVsbG8="}}`, want: "aGVsbG8= hello"},
+	}
+	for _, testCase := range tests {
+		_, body, err := Response().BodyTemplate(testCase.tmpl).render(request)
+		if assert.NoErrorf(t, err, "unexpected error for template: %s", testCase.tmpl) {
+			assert.Equalf(t, testCase.want, string(body), "unexpected rendered body for template: %s", testCase.tmpl)
+		}
+	}
+	assert.Equal(t, `{"name": "baz", "tags": ["a", "b"]}`, string(MustReadAll(t, request.Body)), "request body was expected to be restored")
+}
+
+func TestResponse_BodyTemplateHelpers(t *testing.T) {
+	request := &http.Request{}
+	_, body, err := Response().BodyTemplate(`{{uuid}}`).render(request)
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"), string(body))
+	_, other, err := Response().BodyTemplate(`{{uuid}}`).render(request)
+	require.NoError(t, err)
+	assert.NotEqual(t, string(body), string(other), "expected a new UUID on each render")
+
+	_, body, err = Response().BodyTemplate(`{{timestamp}} {{now.Year}}`).render(request)
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}.* \d{4}$`), string(body))
+}
+
+func TestResponse_HeaderTemplate(t *testing.T) {
+	request := &http.Request{Method: "GET", Header: http.Header{"X-Request-Id": []string{"req-1"}}}
+	res := Response().
+		Header("X-Static", "static").
+		HeaderTemplate("x-request-id", `{{.Header.Get "X-Request-Id"}}`).
+		HeaderTemplate("X-Method", "{{.Method}}")
+	header, _, err := res.render(request)
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{"X-Static": {"static"}, "X-Request-Id": {"req-1"}, "X-Method": {"GET"}}, header)
+	assert.Equal(t, http.Header{"X-Static": {"static"}}, res.header, "response definition was not expected to change")
+
+	header, _, err = res.Header("X-Method", "overridden").render(request)
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{"X-Static": {"static"}, "X-Request-Id": {"req-1"}, "X-Method": {"overridden"}}, header)
+}
+
+func TestResponse_TemplateErrors(t *testing.T) {
+	assert.Panics(t, func() { Response().BodyTemplate("{{.Method") }, "expected a panic for an invalid template")
+	assert.Panics(t, func() { Response().HeaderTemplate("X-Foo", "{{unknownFunc}}") }, "expected a panic for an invalid template")
+
+	_, _, err := Response().BodyTemplate(`{{base64Decode "not base64!"}}`).render(&http.Request{})
+	assert.Error(t, err, "expected an error when rendering the template fails")
+}
+
+func TestResponse_BodyOverridesBodyTemplate(t *testing.T) {
+	_, body, err := Response().BodyTemplate("{{.Method}}").BodyString("static").render(&http.Request{Method: "GET"})
+	require.NoError(t, err)
+	assert.Equal(t, "static", string(body))
+}
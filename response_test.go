@@ -1,8 +1,10 @@
 package mockhttp
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -33,3 +35,35 @@ func TestResponse_BodyString(t *testing.T) {
 	res := Response().BodyString("Hello World!")
 	assert.Equal(t, []byte("Hello World!"), res.body)
 }
+
+func TestResponse_ExpandPathParams(t *testing.T) {
+	request := withPathParams(&http.Request{URL: &url.URL{Path: "/repos/foo/items/a/b"}}, map[string]string{"repo": "foo", "id": "a/b"})
+
+	res := Response().
+		Header("Location", "/repos/{repo}/items/{id}").
+		BodyString(`{"repo": "{repo}", "id": "{id}", "other": "{other}"}`)
+	header, body, err := res.render(request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.Header{"Location": []string{"/repos/{repo}/items/{id}"}}, header, "header was not expected to be expanded")
+	assert.Equal(t, `{"repo": "{repo}", "id": "{id}", "other": "{other}"}`, string(body), "body was not expected to be expanded")
+
+	header, body, err = res.ExpandPathParams().render(request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.Header{"Location": []string{"/repos/foo/items/a/b"}}, header, "unexpected expanded header")
+	assert.Equal(t, `{"repo": "foo", "id": "a/b", "other": "{other}"}`, string(body), "unexpected expanded body")
+	assert.Equal(t, http.Header{"Location": []string{"/repos/{repo}/items/{id}"}}, res.header, "response definition was not expected to change")
+}
+
+func TestResponse_Wait(t *testing.T) {
+	assert.NoError(t, Response().wait(context.Background()), "unexpected error waiting without delay")
+
+	start := time.Now()
+	assert.NoError(t, Response().Delay(50*time.Millisecond).wait(context.Background()), "unexpected error waiting for delay")
+	assert.True(t, time.Since(start) >= 50*time.Millisecond, "expected to wait for the delay")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	assert.Equal(t, context.DeadlineExceeded, Response().Delay(time.Minute).wait(ctx), "unexpected error when context is done")
+	assert.True(t, time.Since(start) < time.Second, "expected waiting to be aborted when context is done")
+}
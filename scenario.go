@@ -0,0 +1,93 @@
+package mockhttp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// ScenarioStarted is the initial state of every scenario
+const ScenarioStarted = "Started"
+
+// scenarios holds the current states of named scenarios. Safe for concurrent use.
+type scenarios struct {
+	mtx    sync.RWMutex
+	states map[string]string
+}
+
+func newScenarios() *scenarios {
+	return &scenarios{
+		states: map[string]string{},
+	}
+}
+
+func (s *scenarios) state(name string) string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if state, ok := s.states[name]; ok {
+		return state
+	}
+	return ScenarioStarted
+}
+
+func (s *scenarios) setState(name, state string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.states[name] = state
+}
+
+// compareAndSet moves the given scenario to the given state (or keeps its state if empty), if the scenario is in the
+// expected state (or in any state if empty) and use returns true. The check and the transition are atomic, use is
+// called only if the scenario is in the expected state. Returns false if the scenario was not moved.
+func (s *scenarios) compareAndSet(name, expected, state string, use func() bool) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	current, ok := s.states[name]
+	if !ok {
+		current = ScenarioStarted
+	}
+	if expected != "" && current != expected {
+		return false
+	}
+	if !use() {
+		return false
+	}
+	if state != "" {
+		s.states[name] = state
+	}
+	return true
+}
+
+func (s *scenarios) reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.states = map[string]string{}
+}
+
+type scenariosKey struct{}
+
+func withScenarios(request *http.Request, s *scenarios) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), scenariosKey{}, s))
+}
+
+// scenarioState returns the state of the given scenario, as seen by the given request. Requests which are not handled
+// by a mock http server (e.g. by a mock http client) see every scenario in its initial state.
+func scenarioState(request *http.Request, name string) string {
+	if s, ok := request.Context().Value(scenariosKey{}).(*scenarios); ok {
+		return s.state(name)
+	}
+	return ScenarioStarted
+}
+
+// compareAndSetScenarioState moves the given scenario to the given state, as seen by the given request (see
+// scenarios.compareAndSet). For requests which are not handled by a mock http server, only the expected state is
+// checked, as they see every scenario in its initial state.
+func compareAndSetScenarioState(request *http.Request, name, expected, state string, use func() bool) bool {
+	if s, ok := request.Context().Value(scenariosKey{}).(*scenarios); ok {
+		return s.compareAndSet(name, expected, state, use)
+	}
+	if expected != "" && expected != ScenarioStarted {
+		return false
+	}
+	return use()
+}
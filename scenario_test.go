@@ -0,0 +1,49 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	s := newScenarios()
+	assert.Equal(t, ScenarioStarted, s.state("foo"), "unexpected initial state")
+	s.setState("foo", "uploaded")
+	assert.Equal(t, "uploaded", s.state("foo"), "unexpected state after transition")
+	assert.Equal(t, ScenarioStarted, s.state("bar"), "other scenarios were not expected to change")
+	s.reset()
+	assert.Equal(t, ScenarioStarted, s.state("foo"), "unexpected state after reset")
+}
+
+func TestScenarios_CompareAndSet(t *testing.T) {
+	s := newScenarios()
+	used := 0
+	use := func() bool {
+		used++
+		return used <= 2
+	}
+	assert.False(t, s.compareAndSet("foo", "uploaded", "deleted", use), "expected no transition from another state")
+	assert.Equal(t, 0, used, "expected the endpoint not to be used in another state")
+	assert.True(t, s.compareAndSet("foo", ScenarioStarted, "uploaded", use), "expected a transition from the expected state")
+	assert.Equal(t, "uploaded", s.state("foo"), "unexpected state after transition")
+	assert.True(t, s.compareAndSet("foo", "", "", use), "expected any state to match")
+	assert.Equal(t, "uploaded", s.state("foo"), "expected the state to stay the same")
+	assert.False(t, s.compareAndSet("foo", "uploaded", "deleted", use), "expected no transition when the endpoint cannot be used")
+	assert.Equal(t, "uploaded", s.state("foo"), "expected the state to stay the same")
+}
+
+func TestScenarios_Request(t *testing.T) {
+	use := func() bool { return true }
+	request := &http.Request{}
+	assert.Equal(t, ScenarioStarted, scenarioState(request, "foo"), "request without scenarios expected to see the initial state")
+	assert.True(t, compareAndSetScenarioState(request, "foo", ScenarioStarted, "uploaded", use), "request without scenarios expected to see the initial state")
+	assert.False(t, compareAndSetScenarioState(request, "foo", "uploaded", "deleted", use), "request without scenarios expected to see the initial state")
+	assert.Equal(t, ScenarioStarted, scenarioState(request, "foo"), "request without scenarios expected to see the initial state")
+
+	s := newScenarios()
+	request = withScenarios(request, s)
+	assert.True(t, compareAndSetScenarioState(request, "foo", "", "uploaded", use), "expected a transition")
+	assert.Equal(t, "uploaded", scenarioState(request, "foo"), "unexpected state after transition")
+	assert.Equal(t, "uploaded", s.state("foo"), "unexpected state after transition")
+}
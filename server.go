@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -31,17 +32,34 @@ func WithTls(config *tls.Config) ServerOpt {
 	}
 }
 
+// WithResponseBodyLimit sets the maximum number of response body bytes recorded for each request (see
+// RecordedRequest.Response). The response body is sent in full, but bytes beyond the limit are not recorded. A
+// negative limit means no limit.
+//
+// Set to DefaultResponseBodyLimit if not explicitly set.
+func WithResponseBodyLimit(limit int) ServerOpt {
+	return func(s *Server) {
+		s.responseBodyLimit = limit
+	}
+}
+
 // WithEndpoints sets the endpoints the server shall handle
 func WithEndpoints(endpoints ...ServerEndpoint) ServerOpt {
 	return func(s *Server) {
-		s.endpoints = endpoints
+		s.endpoints.clear()
+		for _, endpoint := range endpoints {
+			s.endpoints.add(endpoint)
+		}
 	}
 }
 
 func defaultServer() *Server {
 	return &Server{
-		name:            "anonymous",
-		requestRecorder: newRequestRecorder(),
+		name:              "anonymous",
+		endpoints:         newEndpointRegistry(),
+		requestRecorder:   newRequestRecorder(),
+		scenarios:         newScenarios(),
+		responseBodyLimit: DefaultResponseBodyLimit,
 	}
 }
 
@@ -52,16 +70,13 @@ func defaultServer() *Server {
 //   - Name: "anonymous"
 //   - TLS disabled
 //   - No handled endpoints - all requests return 404
+//   - Response body limit: DefaultResponseBodyLimit
 //
 // Make sure to close the server when done. A common practice is to use:
 //   server := StartServer() // Configure as needed
 //   defer server.Close()
 func StartServer(opts ...ServerOpt) *Server {
-	mockSvr := defaultServer()
-	for _, opt := range opts {
-		opt(mockSvr)
-	}
-
+	mockSvr := NewServer(opts...)
 	mockSvr.server = httptest.NewUnstartedServer(&httpHandler{mockSvr: mockSvr})
 	if mockSvr.tlsConfig != nil {
 		mockSvr.server.TLS = mockSvr.tlsConfig
@@ -79,18 +94,37 @@ func StartServer(opts ...ServerOpt) *Server {
 	return mockSvr
 }
 
+// NewServer creates a new mock http server, without starting it
+//
+// The server is configured using the provided functional options, with the same defaults as StartServer. It does not
+// listen on a port, so it handles requests only via its Transport. Its base URL is "http://localhost" ("https" with
+// TLS), without a port. Closing the server is not required.
+func NewServer(opts ...ServerOpt) *Server {
+	mockSvr := defaultServer()
+	for _, opt := range opts {
+		opt(mockSvr)
+	}
+	return mockSvr
+}
+
 // Server is a mock http server
 type Server struct {
-	Port            int
-	name            string
-	server          *httptest.Server
-	endpoints       []ServerEndpoint
-	requestRecorder *requestRecorder
-	tlsConfig       *tls.Config
+	Port              int
+	name              string
+	server            *httptest.Server
+	endpoints         *endpointRegistry
+	requestRecorder   *requestRecorder
+	tlsConfig         *tls.Config
+	scenarios         *scenarios
+	allowUnmatched    bool
+	responseBodyLimit int
 }
 
 // Close (shutdown) the server
 func (mockSvr *Server) Close() {
+	if mockSvr.server == nil {
+		return
+	}
 	fmt.Printf("Closing mock server '%s'.\n", mockSvr.name)
 	mockSvr.server.Close()
 }
@@ -100,11 +134,16 @@ func (mockSvr *Server) Close() {
 // The URL is constructed based on whether TLS is enabled ("http" or "https") and on the port the server started with.
 // An example base URL would be:
 //   http://localhost:54756
+//
+// The base URL of a server which was not started (see NewServer) has no port, e.g. "http://localhost".
 func (mockSvr *Server) BaseUrl() string {
 	scheme := "http"
 	if mockSvr.tlsConfig != nil {
 		scheme = "https"
 	}
+	if mockSvr.server == nil {
+		return fmt.Sprintf("%s://localhost", scheme)
+	}
 	return fmt.Sprintf("%s://localhost:%d", scheme, mockSvr.Port)
 }
 
@@ -117,26 +156,61 @@ func (mockSvr *Server) BuildUrl(path string) string {
 	return fmt.Sprintf("%s%s", mockSvr.BaseUrl(), path)
 }
 
-// AddEndpoint adds an endpoint to this server
-func (mockSvr *Server) AddEndpoint(endpoint ServerEndpoint) {
-	mockSvr.endpoints = append(mockSvr.endpoints, endpoint)
+// AddEndpoint adds an endpoint to this server, after all existing endpoints. Returns an ID which can be used for
+// removing or replacing the endpoint later on.
+//
+// Safe to call at any time, also while the server handles requests.
+func (mockSvr *Server) AddEndpoint(endpoint ServerEndpoint) EndpointID {
+	return mockSvr.endpoints.add(endpoint)
+}
+
+// RemoveEndpoint removes the endpoint with the given ID from this server. Returns false if there is no such endpoint.
+//
+// Safe to call at any time, also while the server handles requests.
+func (mockSvr *Server) RemoveEndpoint(id EndpointID) bool {
+	return mockSvr.endpoints.remove(id)
 }
 
-// Clear request history and remove all endpoints defined for this server
+// ReplaceEndpoint replaces the endpoint with the given ID with a new endpoint, keeping its ID and position (the order
+// in which endpoints are matched). Returns false if there is no such endpoint.
 //
-// Helpful when reusing the same mock http server for multiple tests, to make sure a clean start
+// Safe to call at any time, also while the server handles requests.
+func (mockSvr *Server) ReplaceEndpoint(id EndpointID, endpoint ServerEndpoint) bool {
+	return mockSvr.endpoints.replace(id, endpoint)
+}
+
+// Clear request history, remove all endpoints defined for this server and reset all scenarios
+//
+// Helpful when reusing the same mock http server for multiple tests, to make sure a clean start. Safe to call at any
+// time, also while the server handles requests.
 func (mockSvr *Server) Clear() {
-	mockSvr.endpoints = []ServerEndpoint{}
+	mockSvr.endpoints.clear()
 	mockSvr.ClearHistory()
+	mockSvr.ResetScenarios()
+}
+
+// ScenarioState gets the current state of the scenario with the given name (ScenarioStarted if not changed yet)
+func (mockSvr *Server) ScenarioState(name string) string {
+	return mockSvr.scenarios.state(name)
+}
+
+// SetScenarioState sets the current state of the scenario with the given name
+func (mockSvr *Server) SetScenarioState(name, state string) {
+	mockSvr.scenarios.setState(name, state)
+}
+
+// ResetScenarios resets all scenarios of this server to their initial state (ScenarioStarted)
+func (mockSvr *Server) ResetScenarios() {
+	mockSvr.scenarios.reset()
 }
 
 // AcceptedRequests gets all requests which got to this server and were handled by one of the defined endpoints
-func (mockSvr *Server) AcceptedRequests() []recordedRequest {
+func (mockSvr *Server) AcceptedRequests() []RecordedRequest {
 	return mockSvr.requestRecorder.AcceptedRequests()
 }
 
 // UnmatchedRequests gets all requests which got to this server but did not match any of the defined endpoints
-func (mockSvr *Server) UnmatchedRequests() []recordedRequest {
+func (mockSvr *Server) UnmatchedRequests() []RecordedRequest {
 	return mockSvr.requestRecorder.UnmatchedRequests()
 }
 
@@ -159,6 +233,62 @@ func (mockSvr *Server) Verify(matcher *requestMatcher, opts ...verifyOpt) error
 	return newVerifier(matcher, opts...).verifyRequests(mockSvr.requestRecorder)
 }
 
+// VerifyInOrder verifies that this server received requests matching the given request matchers, in the given order.
+// Other requests may be received before, after and in between. If it does not match the expectation, an error is
+// returned (listing the actual requests timeline), otherwise returns nil.
+//
+// For example:
+//   // verify that a session was created, then used, and deleted last
+//   err := server.VerifyInOrder(
+//   	Request().POST("/session"),
+//   	Request().GET("/data"),
+//   	Request().DELETE("/session"))
+func (mockSvr *Server) VerifyInOrder(matchers ...*requestMatcher) error {
+	return verifyInOrder(mockSvr.requestRecorder, false, matchers...)
+}
+
+// VerifyInStrictOrder verifies that this server received requests matching the given request matchers, in the given
+// order, with no other requests in between. Other requests may be received before and after. If it does not match the
+// expectation, an error is returned (listing the actual requests timeline), otherwise returns nil.
+func (mockSvr *Server) VerifyInStrictOrder(matchers ...*requestMatcher) error {
+	return verifyInOrder(mockSvr.requestRecorder, true, matchers...)
+}
+
+// VerifyNoMoreInteractions verifies that all requests received by this server (both accepted and unmatched) were
+// covered by previous successful verifications (Verify, VerifyInOrder or VerifyInStrictOrder). Helps catching
+// unexpected extra requests sent by the code under test. If there are requests which were not verified, an error is
+// returned listing them, otherwise returns nil.
+//
+// For example:
+//   err := server.Verify(Request().GET("/foo"), Times(2))
+//   // ...
+//   err = server.VerifyNoMoreInteractions()
+func (mockSvr *Server) VerifyNoMoreInteractions() error {
+	return verifyNoMoreInteractions(mockSvr.requestRecorder)
+}
+
+// VerifyExpectations verifies the expectations declared on the endpoints of this server (see the server endpoint's
+// Expect). Returns a single error listing all endpoints which did not meet their expectations, or nil if all
+// expectations are met.
+//
+// For example:
+//   server := StartServer(WithEndpoints(
+//   	NewServerEndpoint().When(Request().GET("/foo")).Expect(Times(2)),
+//   	NewServerEndpoint().When(Request().DELETE("/foo")).Expect(Never())))
+//   defer server.Close()
+//   // ... run the code under test
+//   if err := server.VerifyExpectations(); err != nil {
+//   	t.Errorf("%v", err)
+//   }
+func (mockSvr *Server) VerifyExpectations() error {
+	endpoints := mockSvr.endpoints.all()
+	res := make([]expectationVerifier, len(endpoints))
+	for i, endpoint := range endpoints {
+		res[i] = expectationVerifierOf(endpoint)
+	}
+	return verifyExpectations(res)
+}
+
 // WaitFor waits for a request (matching the given matcher) to be received by the server, no matter if an matching endpoint is
 // defined. The provided context can be used e.g. for setting a timeout. Returns an error e.g. when waiting has timed out.
 //
@@ -169,24 +299,85 @@ func (mockSvr *Server) Verify(matcher *requestMatcher, opts ...verifyOpt) error
 //   err := server.WaitFor(ctx, Request())
 //
 func (mockSvr *Server) WaitFor(ctx context.Context, matcher *requestMatcher) error {
-	verifier := newVerifier(matcher)
-	countRequests := func() int {
-		accepted := verifier.countRequests(mockSvr.requestRecorder.AcceptedRequests())
-		unmatched := verifier.countRequests(mockSvr.requestRecorder.UnmatchedRequests())
-		return accepted + unmatched
-	}
-	initialCount := countRequests()
-	for {
-		if countRequests() > initialCount {
-			return nil
-		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			time.Sleep(100 * time.Millisecond)
-		}
+	return mockSvr.WaitForN(ctx, matcher, 1)
+}
+
+// WaitForN waits for n requests (matching the given matcher) to be received by the server, no matter if a matching
+// endpoint is defined. Only requests received after the call are counted. Returns an error e.g. when waiting has timed
+// out.
+func (mockSvr *Server) WaitForN(ctx context.Context, matcher *requestMatcher, n int) error {
+	_, err := waitFor(ctx, mockSvr.requestRecorder, matcher, n)
+	return err
+}
+
+// WaitForRequest waits for a request (matching the given matcher) to be received by the server, same as WaitFor, and
+// returns the received request.
+//
+// For example:
+//   ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+//   defer cancel()
+//   request, err := server.WaitForRequest(ctx, Request().POST("/jobs"))
+//
+func (mockSvr *Server) WaitForRequest(ctx context.Context, matcher *requestMatcher) (RecordedRequest, error) {
+	requests, err := waitFor(ctx, mockSvr.requestRecorder, matcher, 1)
+	if err != nil {
+		return RecordedRequest{}, err
 	}
+	return requests[0], nil
+}
+
+// Requests returns a channel which streams the requests received by the server from now on, as they are recorded, no
+// matter if a matching endpoint is defined. If matchers are given, only requests matching all of them are streamed. The
+// channel is closed once the given context is done.
+//
+// For example:
+//   ctx, cancel := context.WithCancel(context.Background())
+//   defer cancel()
+//   for request := range server.Requests(ctx, Request().POST("/jobs")) {
+//   	...
+//   }
+//
+func (mockSvr *Server) Requests(ctx context.Context, matchers ...*requestMatcher) <-chan RecordedRequest {
+	return mockSvr.requestRecorder.subscribe(ctx, matchers...)
+}
+
+// ExportHAR writes all requests received by the server (both accepted and unmatched), along with the recorded
+// responses, to the given writer as an HTTP Archive (HAR 1.2) JSON document. Can be opened e.g. by browser devtools.
+//
+// For example, to attach the recorded traffic to a failed test:
+//   if t.Failed() {
+//   	f, _ := os.Create("mock-server.har")
+//   	defer f.Close()
+//   	_ = server.ExportHAR(f)
+//   }
+//
+func (mockSvr *Server) ExportHAR(w io.Writer) error {
+	return exportHAR(w, mockSvr.requestRecorder.timeline())
+}
+
+// Transport returns an http.RoundTripper which dispatches requests to the endpoints of this server in memory, without
+// opening a connection. Requests are matched, recorded and responded the same way as requests received on the port of
+// the server, so the same endpoints can be used in unit tests and in integration tests. The URL scheme and host of the
+// requests do not matter. For example:
+//   server := NewServer(WithEndpoints(...))
+//   client := &http.Client{Transport: server.Transport()}
+//   res, err := client.Get(server.BuildUrl("/path/to/something"))
+//
+// Requests are sent with TLS connection state if the URL scheme is "https", and with remote address "127.0.0.1:0".
+// Faults are injected into an in-memory connection, which acts as a TCP connection (e.g. ResetConnection makes the
+// client get a connection reset error).
+//
+// A response flushed by a custom handler (see HandleWith) is returned right away, and the rest of its body is streamed
+// as the handler writes it, e.g. for long polling or server-sent events. Closing the response body cancels the request
+// context, like when the client closes the connection.
+//
+// Requests are complete in the recorder of the server once the transport returns the response (or the error). For
+// faults and flushed responses, once the response body is closed. If the request context is done, the transport waits
+// for the endpoint to return, so custom handlers should return once the request context is done.
+//
+// Works for both started and not started servers (see NewServer).
+func (mockSvr *Server) Transport() http.RoundTripper {
+	return &serverTransport{handler: &httpHandler{mockSvr: mockSvr}}
 }
 
 func (mockSvr *Server) String() string {
@@ -197,15 +388,21 @@ type httpHandler struct {
 	mockSvr *Server
 }
 
-func (h *httpHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
-	for _, endpoint := range h.mockSvr.endpoints {
-		if endpoint.Matches(request) {
-			h.mockSvr.requestRecorder.recordAcceptedRequest(request)
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	receivedAt := time.Now()
+	request = withScenarios(request, h.mockSvr.scenarios)
+	response := newRecordingResponseWriter(w, h.mockSvr.responseBodyLimit)
+	for _, registered := range h.mockSvr.endpoints.registered() {
+		endpoint := registered.endpoint
+		if endpoint.Matches(request) && claim(endpoint, request) {
+			id := h.mockSvr.requestRecorder.recordAcceptedRequest(request, receivedAt, registered.id, endpoint)
+			defer func() { h.mockSvr.requestRecorder.completeRequest(id, response.recordedResponse(request.Context())) }()
 			endpoint.ServeHTTP(response, request)
 			return
 		}
 	}
-	h.mockSvr.requestRecorder.recordUnmatchedRequest(request)
+	id := h.mockSvr.requestRecorder.recordUnmatchedRequest(request, receivedAt)
+	defer func() { h.mockSvr.requestRecorder.completeRequest(id, response.recordedResponse(request.Context())) }()
 	response.Header().Set("Content-Type", "text/plain")
 	response.WriteHeader(404)
 	response.Write([]byte("404 page not found"))
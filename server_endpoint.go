@@ -1,8 +1,8 @@
 package mockhttp
 
 import (
+	"fmt"
 	"net/http"
-	"time"
 )
 
 // ServerEndpoint interface, used by a mock http server for handling incoming requests
@@ -14,13 +14,19 @@ type ServerEndpoint interface {
 type serverEndpoint struct {
 	requestMatcher requestMatcher
 	handlerFunc    http.HandlerFunc
+	responses      responseSequence
+	scenario       string
+	requiredState  string
+	newState       string
+	limit          invocationLimit
+	expectations   []verifyOpt
 }
 
 // NewServerEndpoint creates a new server endpoint, to be used for configuring a mock http server
 func NewServerEndpoint() *serverEndpoint {
 	return &serverEndpoint{
 		requestMatcher: requestMatcher{},
-		handlerFunc:    responseAsHandler(Response()),
+		responses:      newResponseSequence(Response()),
 	}
 }
 
@@ -34,7 +40,36 @@ func (e *serverEndpoint) When(matcher *requestMatcher) *serverEndpoint {
 //
 // For more fine grain control, you can use HandleWith function instead.
 func (e *serverEndpoint) Respond(response *response) *serverEndpoint {
-	return e.HandleWith(responseAsHandler(response))
+	return e.RespondInSequence(response)
+}
+
+// RespondInSequence defines the responses this server endpoint should return, one per request in the given order. Once
+// all responses are used, the last response repeats.
+//
+// For example, to fail the first two requests and succeed afterwards:
+//   RespondInSequence(
+//   	Response().StatusCode(http.StatusServiceUnavailable),
+//   	Response().StatusCode(http.StatusServiceUnavailable),
+//   	Response().BodyString("done"))
+func (e *serverEndpoint) RespondInSequence(responses ...*response) *serverEndpoint {
+	e.handlerFunc = nil
+	e.responses.set(false, defaultResponseIfEmpty(responses)...)
+	return e
+}
+
+// RespondInCycle defines the responses this server endpoint should return, one per request in the given order. Once
+// all responses are used, the sequence starts over.
+func (e *serverEndpoint) RespondInCycle(responses ...*response) *serverEndpoint {
+	e.handlerFunc = nil
+	e.responses.set(true, defaultResponseIfEmpty(responses)...)
+	return e
+}
+
+// RespondNth defines the response this server endpoint should return for the n-th request it handles (starting from
+// 1). It takes precedence over any other response or handler defined for this endpoint.
+func (e *serverEndpoint) RespondNth(n int, response *response) *serverEndpoint {
+	e.responses.setNth(n, response)
+	return e
 }
 
 // HandleWith defines a http handler function to use for sending a response when this server endpoints is triggered
@@ -42,32 +77,146 @@ func (e *serverEndpoint) Respond(response *response) *serverEndpoint {
 // For simple cases, it is better to simply set a response to send using Respond function instead.
 func (e *serverEndpoint) HandleWith(handlerFunc http.HandlerFunc) *serverEndpoint {
 	e.handlerFunc = handlerFunc
+	e.responses.set(false)
+	return e
+}
+
+// InScenario sets the name of the scenario this server endpoint takes part in. Scenarios are state machines, shared by
+// all endpoints of a mock http server, which allow an endpoint to behave differently depending on previous requests.
+// Every scenario starts in the ScenarioStarted state.
+//
+// Use InState to restrict the endpoint to a scenario state, and TransitionTo to change the scenario state when the
+// endpoint is triggered. For example, a resource which is found until it is deleted:
+//   NewServerEndpoint().
+//   	When(Request().GET("/foo")).
+//   	InScenario("foo").InState(ScenarioStarted).
+//   	Respond(Response()),
+//   NewServerEndpoint().
+//   	When(Request().DELETE("/foo")).
+//   	InScenario("foo").
+//   	TransitionTo("deleted"),
+//   NewServerEndpoint().
+//   	When(Request().GET("/foo")).
+//   	InScenario("foo").InState("deleted").
+//   	Respond(Response().StatusCode(http.StatusNotFound))
+func (e *serverEndpoint) InScenario(name string) *serverEndpoint {
+	e.scenario = name
+	return e
+}
+
+// InState restricts this server endpoint to handle requests only when its scenario (see InScenario) is in the given
+// state
+func (e *serverEndpoint) InState(state string) *serverEndpoint {
+	e.requiredState = state
+	return e
+}
+
+// TransitionTo sets the state to move this server endpoint's scenario (see InScenario) to, when the endpoint is
+// triggered. The transition takes place before the response is sent.
+func (e *serverEndpoint) TransitionTo(state string) *serverEndpoint {
+	e.newState = state
+	return e
+}
+
+// Times limits the number of requests this server endpoint handles. Once it handled n requests, it no longer matches any
+// request, and the server falls through to the next matching endpoint (or responds with 404 if there is none).
+//
+// For example, to fail the first request and succeed afterwards:
+//   WithEndpoints(
+//   	NewServerEndpoint().When(Request().GET("/foo")).Once().Respond(Response().StatusCode(http.StatusInternalServerError)),
+//   	NewServerEndpoint().When(Request().GET("/foo")).Respond(Response()))
+func (e *serverEndpoint) Times(n int) *serverEndpoint {
+	e.limit.set(n)
+	return e
+}
+
+// Once limits this server endpoint to handle a single request. A shortcut for Times(1).
+func (e *serverEndpoint) Once() *serverEndpoint {
+	return e.Times(1)
+}
+
+// Expect declares how many requests this server endpoint is expected to handle, using verify options (e.g. Times,
+// AtLeast, AtMost, Never). Without options, the endpoint is expected to handle exactly one request. Expectations are
+// verified using the server's VerifyExpectations, and automatically for test servers (see NewTestServer).
+//
+// For example:
+//   NewServerEndpoint().
+//   	When(Request().GET("/foo")).
+//   	Respond(Response()).
+//   	Expect(Times(2))
+func (e *serverEndpoint) Expect(opts ...verifyOpt) *serverEndpoint {
+	e.expectations = append([]verifyOpt{}, opts...)
 	return e
 }
 
 // Matches used internally to check if this server endpoint matches the given request and should handle it.
+// An endpoint which reached its invocation limit (see Times) does not match. Checking a match does not use the endpoint.
 // This is part of the ServerEndpoint interface.
 func (e *serverEndpoint) Matches(request *http.Request) bool {
-	return e.requestMatcher.matches(request)
+	if e.requiredState != "" && scenarioState(request, e.scenario) != e.requiredState {
+		return false
+	}
+	return e.requestMatcher.matches(request) && e.limit.available()
+}
+
+// claim uses this server endpoint once (see Times), and moves its scenario to the new state (see TransitionTo). Checking
+// the scenario state (see InState) and the transition are atomic, so of concurrent requests in the required state
+// only one moves the scenario on. Returns false if the invocation limit is reached, or the scenario is not in the
+// required state.
+func (e *serverEndpoint) claim(request *http.Request) bool {
+	if e.requiredState == "" && e.newState == "" {
+		return e.limit.tryUse()
+	}
+	return compareAndSetScenarioState(request, e.scenario, e.requiredState, e.newState, e.limit.tryUse)
 }
 
 // ServeHTTP used internally, this is the http.Handler implementation of the server endpoint.
 // This is part of the ServerEndpoint interface.
 func (e *serverEndpoint) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	request = withPathParams(request, e.requestMatcher.pathParams(request))
+	if r := e.responses.next(); r != nil {
+		responseAsHandler(r)(response, request)
+		return
+	}
 	e.handlerFunc(response, request)
 }
 
 func responseAsHandler(r *response) http.HandlerFunc {
 	return func(response http.ResponseWriter, request *http.Request) {
-		if r.delay > 0 {
-			time.Sleep(r.delay)
+		if err := r.wait(request.Context()); err != nil {
+			// the client is gone, there is no one to respond to
+			return
+		}
+		header, body, err := r.render(request)
+		if err != nil {
+			http.Error(response, fmt.Sprintf("could not render response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if r.fault != nil {
+			injectFault(response, r.fault, r.statusCode, header, body)
+			return
+		}
+		if r.bodyReadErr != nil {
+			injectFault(response, TruncateBody(r.bodyReadErrAfter), r.statusCode, header, body)
+			return
 		}
-		for name, values := range r.header {
+		for name, values := range header {
 			for _, v := range values {
 				response.Header().Add(name, v)
 			}
 		}
 		response.WriteHeader(r.statusCode)
-		response.Write(r.body)
+		response.Write(body)
 	}
 }
+
+func (e *serverEndpoint) verifyExpectations() error {
+	if e.expectations == nil {
+		return nil
+	}
+	return verifyCount(e.responses.callCount(), e.expectations...)
+}
+
+func (e *serverEndpoint) String() string {
+	return fmt.Sprintf("Request(%s)", e.requestMatcher.String())
+}
@@ -47,3 +47,13 @@ func TestServerEndpoint_responseAsHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestServerEndpoint_MatchesDoesNotUseEndpoint(t *testing.T) {
+	endpoint := NewServerEndpoint().When(Request().GET("/foo")).Once()
+	request := httptest.NewRequest("GET", "/foo", nil)
+	assert.True(t, endpoint.Matches(request), "expected endpoint to match")
+	assert.True(t, endpoint.Matches(request), "expected endpoint to match again, as matching does not use it")
+	assert.True(t, claim(endpoint, request), "expected the first claim to succeed")
+	assert.False(t, claim(endpoint, request), "expected the second claim to fail")
+	assert.False(t, endpoint.Matches(request), "expected endpoint not to match once its limit is reached")
+}
@@ -0,0 +1,38 @@
+//go:build go1.20
+// +build go1.20
+
+package mockhttp_test
+
+import (
+	"github.com/jfrog/go-mockhttp"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServer_ResponseController(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/deadline")).
+			HandleWith(func(w http.ResponseWriter, r *http.Request) {
+				controller := http.NewResponseController(w)
+				if err := controller.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if err := controller.SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				_, _ = w.Write([]byte("ok"))
+				_ = controller.Flush()
+			})))
+	defer server.Close()
+
+	assertGetReturns(t, server.BuildUrl("/deadline"), http.StatusOK, "ok")
+	accepted := server.AcceptedRequests()
+	if assert.Equal(t, 1, len(accepted), "unexpected number of accepted requests") {
+		assert.Equal(t, "ok", accepted[0].Response.BodyAsString(), "expected the response to be recorded")
+	}
+}
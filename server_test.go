@@ -1,14 +1,22 @@
 package mockhttp_test
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jfrog/go-mockhttp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -299,6 +307,401 @@ func TestServer_Verify(t *testing.T) {
 	assertErrorMatches(t, server.Verify(mockhttp.Request().GET("/bar"), mockhttp.Times(2)), regexp.MustCompile("request was called unexpected number of times. expected: 2, actual: 1.*"))
 }
 
+func TestServer_VerifyBodyJSON(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().POST("/items").BodyJSONSubset(map[string]string{"kind": "file"})).
+			Respond(mockhttp.Response().StatusCode(http.StatusCreated))))
+	defer server.Close()
+
+	res, err := http.Post(server.BuildUrl("/items"), "application/json", strings.NewReader(`{"name": "foo", "kind": "file"}`))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode, "unexpected response status code")
+	res, err = http.Post(server.BuildUrl("/items"), "application/json", strings.NewReader(`{"name": "bar", "kind": "folder"}`))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode, "unexpected response status code")
+
+	assert.NoError(t, server.Verify(mockhttp.Request().POST("/items").BodyJSON(map[string]string{"name": "foo", "kind": "file"})))
+	assert.NoError(t, server.Verify(mockhttp.Request().POST("/items").BodyJSONPath("$.kind", "folder")))
+	assert.NoError(t, server.Verify(mockhttp.Request().POST("/items").BodyJSONSubset(map[string]string{}), mockhttp.Times(2)))
+	assertErrorMatches(t, server.Verify(mockhttp.Request().BodyJSONPath("$.name", "baz")), regexp.MustCompile(`(?s)expected: BodyJSONPath\(\$\.name: "baz"\)`))
+}
+
+func TestServer_BodyMatchersRestoreBody(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().POST("/echo").BodyContains("ping")).
+			HandleWith(func(response http.ResponseWriter, request *http.Request) {
+				body, err := ioutil.ReadAll(request.Body)
+				if err != nil {
+					response.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = response.Write(body)
+			})))
+	defer server.Close()
+
+	res, err := http.Post(server.BuildUrl("/echo"), "text/plain", strings.NewReader("ping pong"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "unexpected response status code")
+	assert.Equal(t, "ping pong", string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+	assert.Equal(t, "ping pong", server.AcceptedRequests()[0].BodyAsString(), "unexpected recorded request body")
+	assert.NoError(t, server.Verify(mockhttp.Request().BodyString("ping pong")))
+	assert.NoError(t, server.Verify(mockhttp.Request().BodyMatches(regexp.MustCompile("^ping")), mockhttp.Once()))
+}
+
+func TestServer_LogicalMatchers(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.AnyOf(mockhttp.Request().Path("/a"), mockhttp.Request().Path("/b"))).
+			Respond(mockhttp.Response())))
+	defer server.Close()
+
+	assertGetReturns(t, server.BuildUrl("/a"), 200, "")
+	assertGetReturns(t, server.BuildUrl("/b"), 200, "")
+	assertGetReturns(t, server.BuildUrl("/c"), 404, anyResponseBody)
+
+	assert.NoError(t, server.Verify(mockhttp.AllOf(mockhttp.Request().Method("GET"), mockhttp.Not(mockhttp.Request().Path("/c"))), mockhttp.Times(2)))
+	assertErrorMatches(t, server.Verify(mockhttp.AnyOf(mockhttp.Request().Method("POST"), mockhttp.Request().Method("HEAD"))),
+		regexp.MustCompile(`(?s)expected: AnyOf\(Method\(POST\),Method\(HEAD\)\)`))
+}
+
+func TestServer_PathTemplate(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().PathTemplate("/echo/{repo}/{id...}")).
+			HandleWith(func(response http.ResponseWriter, request *http.Request) {
+				_, _ = response.Write([]byte(mockhttp.PathParam(request, "repo") + ":" + mockhttp.PathParam(request, "id")))
+			}),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().Method("GET").PathTemplate("/api/repos/{repo}/items/{id...}")).
+			Respond(mockhttp.Response().
+				Header("X-Repo", "{repo}").
+				BodyString(`{"repo": "{repo}", "id": "{id}"}`).
+				ExpandPathParams())))
+	defer server.Close()
+
+	res, err := http.Get(server.BuildUrl("/api/repos/foo/items/a/b"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "unexpected response status code")
+	assert.Equal(t, "foo", res.Header.Get("X-Repo"), "unexpected response header")
+	assert.Equal(t, `{"repo": "foo", "id": "a/b"}`, string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+	assertGetReturns(t, server.BuildUrl("/api/repos/foo"), 404, anyResponseBody)
+	assertGetReturns(t, server.BuildUrl("/echo/bar/x/y/z"), 200, "bar:x/y/z")
+}
+
+func TestServer_ResponseTemplate(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().Method("PUT").PathTemplate("/repos/{repo}")).
+			Respond(mockhttp.Response().
+				HeaderTemplate("X-Request-Id", `{{.Header.Get "X-Request-Id"}}`).
+				BodyTemplate(`{"repo": "{{.PathParams.repo}}", "description": {{toJSON .JSON.description}}}`)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().Method("GET")).
+			Respond(mockhttp.Response().BodyTemplate(`{{index .JSON "missing"}}`))))
+	defer server.Close()
+
+	req, err := http.NewRequest("PUT", server.BuildUrl("/repos/foo"), strings.NewReader(`{"description": "my repo"}`))
+	require.NoError(t, err)
+	req.Header.Set("X-Request-Id", "req-123")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "unexpected response status code")
+	assert.Equal(t, "req-123", res.Header.Get("X-Request-Id"), "unexpected response header")
+	assert.Equal(t, `{"repo": "foo", "description": "my repo"}`, string(mockhttp.MustReadAll(t, res.Body)), "unexpected response body")
+
+	// Failing to render a template responds with an internal server error
+	res, err = http.Get(server.BuildUrl("/repos/foo"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "unexpected response status code")
+	assert.Contains(t, string(mockhttp.MustReadAll(t, res.Body)), "could not render response", "unexpected response body")
+}
+
+func TestServer_RespondInSequence(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/retry")).
+			RespondInSequence(
+				mockhttp.Response().StatusCode(http.StatusServiceUnavailable),
+				mockhttp.Response().StatusCode(http.StatusBadGateway),
+				mockhttp.Response().BodyString("done")),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/cycle")).
+			RespondInCycle(
+				mockhttp.Response().BodyString("tick"),
+				mockhttp.Response().BodyString("tock")).
+			RespondNth(4, mockhttp.Response().StatusCode(http.StatusTeapot).BodyString("teapot")),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/custom")).
+			HandleWith(func(response http.ResponseWriter, request *http.Request) {
+				_, _ = response.Write([]byte("custom"))
+			}).
+			RespondNth(2, mockhttp.Response().StatusCode(http.StatusInternalServerError).BodyString("failure"))))
+	defer server.Close()
+
+	assertGetReturns(t, server.BuildUrl("/retry"), http.StatusServiceUnavailable, "")
+	assertGetReturns(t, server.BuildUrl("/retry"), http.StatusBadGateway, "")
+	assertGetReturns(t, server.BuildUrl("/retry"), http.StatusOK, "done")
+	assertGetReturns(t, server.BuildUrl("/retry"), http.StatusOK, "done")
+
+	assertGetReturns(t, server.BuildUrl("/cycle"), http.StatusOK, "tick")
+	assertGetReturns(t, server.BuildUrl("/cycle"), http.StatusOK, "tock")
+	assertGetReturns(t, server.BuildUrl("/cycle"), http.StatusOK, "tick")
+	assertGetReturns(t, server.BuildUrl("/cycle"), http.StatusTeapot, "teapot")
+	assertGetReturns(t, server.BuildUrl("/cycle"), http.StatusOK, "tick")
+
+	assertGetReturns(t, server.BuildUrl("/custom"), http.StatusOK, "custom")
+	assertGetReturns(t, server.BuildUrl("/custom"), http.StatusInternalServerError, "failure")
+	assertGetReturns(t, server.BuildUrl("/custom"), http.StatusOK, "custom")
+}
+
+func TestServer_Scenarios(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().PUT("/file")).
+			InScenario("file").
+			TransitionTo("uploaded").
+			Respond(mockhttp.Response().StatusCode(http.StatusCreated)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/file")).
+			InScenario("file").InState("uploaded").
+			Respond(mockhttp.Response().BodyString("content")),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().DELETE("/file")).
+			InScenario("file").InState("uploaded").
+			TransitionTo("deleted").
+			Respond(mockhttp.Response().StatusCode(http.StatusNoContent)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/file")).
+			InScenario("file").
+			Respond(mockhttp.Response().StatusCode(http.StatusNotFound).BodyString("not found"))))
+	defer server.Close()
+
+	doRequest := func(method string, expectedStatus int) {
+		req, err := http.NewRequest(method, server.BuildUrl("/file"), nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		assert.Equalf(t, expectedStatus, res.StatusCode, "unexpected response status code for %s, scenario state: %s", method, server.ScenarioState("file"))
+	}
+
+	assert.Equal(t, mockhttp.ScenarioStarted, server.ScenarioState("file"), "unexpected initial scenario state")
+	doRequest("GET", http.StatusNotFound)
+	doRequest("DELETE", http.StatusNotFound)
+	doRequest("PUT", http.StatusCreated)
+	assert.Equal(t, "uploaded", server.ScenarioState("file"), "unexpected scenario state")
+	doRequest("GET", http.StatusOK)
+	doRequest("DELETE", http.StatusNoContent)
+	assert.Equal(t, "deleted", server.ScenarioState("file"), "unexpected scenario state")
+	doRequest("GET", http.StatusNotFound)
+
+	server.SetScenarioState("file", "uploaded")
+	doRequest("GET", http.StatusOK)
+	server.ResetScenarios()
+	assert.Equal(t, mockhttp.ScenarioStarted, server.ScenarioState("file"), "unexpected scenario state after reset")
+	doRequest("GET", http.StatusNotFound)
+
+	server.SetScenarioState("file", "uploaded")
+	server.Clear()
+	assert.Equal(t, mockhttp.ScenarioStarted, server.ScenarioState("file"), "unexpected scenario state after clear")
+}
+
+func TestServer_ScenarioTransitionWithConcurrentRequests(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			// a slow match, so all requests see the initial state before any of them transitions
+			When(mockhttp.Request().POST("/lock").BodyFunc(func([]byte) bool {
+				time.Sleep(20 * time.Millisecond)
+				return true
+			})).
+			InScenario("lock").InState(mockhttp.ScenarioStarted).
+			TransitionTo("locked").
+			Respond(mockhttp.Response().StatusCode(http.StatusCreated)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().POST("/lock")).
+			Respond(mockhttp.Response().StatusCode(http.StatusConflict))))
+	defer server.Close()
+
+	statuses := make(chan int, 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := http.Post(server.BuildUrl("/lock"), "text/plain", nil)
+			if assert.NoError(t, err) {
+				_ = res.Body.Close()
+				statuses <- res.StatusCode
+			}
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	created := 0
+	for status := range statuses {
+		if status == http.StatusCreated {
+			created++
+		} else {
+			assert.Equal(t, http.StatusConflict, status, "unexpected response status code")
+		}
+	}
+	assert.Equal(t, 1, created, "expected a single request to transition the scenario")
+	assert.Equal(t, "locked", server.ScenarioState("lock"), "unexpected scenario state")
+}
+
+func TestServer_EndpointTimes(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/foo")).
+			Once().
+			Respond(mockhttp.Response().StatusCode(http.StatusInternalServerError)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/foo")).
+			Times(2).
+			Respond(mockhttp.Response().BodyString("ok"))))
+	defer server.Close()
+
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusInternalServerError, "")
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "ok")
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "ok")
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusNotFound, anyResponseBody)
+	assert.Equal(t, 3, len(server.AcceptedRequests()), "unexpected number of accepted requests")
+	assert.Equal(t, 1, len(server.UnmatchedRequests()), "unexpected number of unmatched requests")
+}
+
+func TestServer_ManageEndpoints(t *testing.T) {
+	server := mockhttp.StartServer()
+	defer server.Close()
+
+	fooID := server.AddEndpoint(mockhttp.NewServerEndpoint().
+		When(mockhttp.Request().GET("/foo")).
+		Respond(mockhttp.Response().BodyString("foo")))
+	anyID := server.AddEndpoint(mockhttp.NewServerEndpoint().
+		Respond(mockhttp.Response().BodyString("any")))
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "foo")
+	assertGetReturns(t, server.BuildUrl("/bar"), http.StatusOK, "any")
+
+	assert.True(t, server.ReplaceEndpoint(fooID, mockhttp.NewServerEndpoint().
+		When(mockhttp.Request().GET("/foo")).
+		Respond(mockhttp.Response().BodyString("new foo"))), "expected endpoint to be replaced")
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "new foo")
+
+	assert.True(t, server.RemoveEndpoint(fooID), "expected endpoint to be removed")
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "any")
+	assert.False(t, server.RemoveEndpoint(fooID), "endpoint was already removed")
+
+	assert.True(t, server.RemoveEndpoint(anyID), "expected endpoint to be removed")
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusNotFound, anyResponseBody)
+}
+
+func TestServer_ManageEndpointsWhileServing(t *testing.T) {
+	server := mockhttp.StartServer()
+	defer server.Close()
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					res, err := http.Get(server.BuildUrl("/foo"))
+					if assert.NoError(t, err) {
+						_ = res.Body.Close()
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		id := server.AddEndpoint(mockhttp.NewServerEndpoint())
+		server.ReplaceEndpoint(id, mockhttp.NewServerEndpoint())
+		server.RemoveEndpoint(id)
+		if i%10 == 0 {
+			server.Clear()
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestServer_VerifyExpectations(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/foo")).
+			Expect(mockhttp.Times(2)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/bar")).
+			Expect(),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().DELETE("/foo")).
+			Expect(mockhttp.Never()),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/baz"))))
+	defer server.Close()
+
+	err := server.VerifyExpectations()
+	assertErrorMatches(t, err, regexp.MustCompile(`^2 endpoints did not meet their expectations:\n`+
+		`   1: Request\(Method\(GET\),Path\(/foo\)\) - request was called unexpected number of times. expected: 2, actual: 0\n`+
+		`   2: Request\(Method\(GET\),Path\(/bar\)\) - request was called unexpected number of times. expected: 1, actual: 0$`))
+
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "")
+	assertGetReturns(t, server.BuildUrl("/bar"), http.StatusOK, "")
+	assertGetReturns(t, server.BuildUrl("/baz"), http.StatusOK, "")
+	err = server.VerifyExpectations()
+	assertErrorMatches(t, err, regexp.MustCompile(`^1 endpoints did not meet their expectations:\n`+
+		`   1: Request\(Method\(GET\),Path\(/foo\)\) - request was called unexpected number of times. expected: 2, actual: 1$`))
+
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "")
+	assert.NoError(t, server.VerifyExpectations())
+}
+
+func TestServer_VerifyInOrder(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(mockhttp.NewServerEndpoint().When(mockhttp.Request().Path("/session"))))
+	defer server.Close()
+
+	for _, method := range []string{"POST", "GET", "DELETE"} {
+		req, err := http.NewRequest(method, server.BuildUrl("/session"), nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		if method == "POST" {
+			assertGetReturns(t, server.BuildUrl("/data"), http.StatusNotFound, anyResponseBody)
+		}
+	}
+
+	assert.NoError(t, server.VerifyInOrder(mockhttp.Request().POST("/session"), mockhttp.Request().GET("/data"), mockhttp.Request().DELETE("/session")))
+	assert.NoError(t, server.VerifyInOrder(mockhttp.Request().POST("/session"), mockhttp.Request().DELETE("/session")))
+	assert.NoError(t, server.VerifyInStrictOrder(mockhttp.Request().POST("/session"), mockhttp.Request().GET("/data"), mockhttp.Request().GET("/session")))
+	assertErrorMatches(t, server.VerifyInStrictOrder(mockhttp.Request().POST("/session"), mockhttp.Request().DELETE("/session")),
+		regexp.MustCompile(`(?s)requests were not received in strict order.*actual  :\n   1: POST /session \(accepted\)\n   2: GET /data \(unmatched\)\n   3: GET /session \(accepted\)\n   4: DELETE /session \(accepted\)\n$`))
+	assertErrorMatches(t, server.VerifyInOrder(mockhttp.Request().DELETE("/session"), mockhttp.Request().POST("/session")),
+		regexp.MustCompile(`^requests were not received in order\n`))
+}
+
+func TestServer_VerifyNoMoreInteractions(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(mockhttp.NewServerEndpoint().When(mockhttp.Request().GET("/foo"))))
+	defer server.Close()
+	assert.NoError(t, server.VerifyNoMoreInteractions())
+
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "")
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "")
+	assertGetReturns(t, server.BuildUrl("/bar"), http.StatusNotFound, anyResponseBody)
+	assert.NoError(t, server.Verify(mockhttp.Request().GET("/foo"), mockhttp.Times(2)))
+	assertErrorMatches(t, server.VerifyNoMoreInteractions(), regexp.MustCompile(`^found 1 unverified requests:\n   1: GET /bar \(unmatched\)\n$`))
+	assert.NoError(t, server.Verify(mockhttp.Request().GET("/bar")))
+	assert.NoError(t, server.VerifyNoMoreInteractions())
+}
+
 func TestServer_WaitFor(t *testing.T) {
 	server := mockhttp.StartServer(mockhttp.WithEndpoints(
 		mockhttp.NewServerEndpoint().
@@ -357,6 +760,515 @@ func TestServer_WaitFor(t *testing.T) {
 	}
 }
 
+func TestServer_WaitForN(t *testing.T) {
+	server := mockhttp.StartServer()
+	defer server.Close()
+
+	assertGetReturns(t, server.BaseUrl()+"/job", http.StatusNotFound, anyResponseBody)
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			assertGetReturns(t, server.BaseUrl()+"/job", http.StatusNotFound, anyResponseBody)
+			assertGetReturns(t, server.BaseUrl()+"/other", http.StatusNotFound, anyResponseBody)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// requests received before the call are not counted
+	assert.NoError(t, server.WaitForN(ctx, mockhttp.Request().GET("/job"), 3))
+	assert.NoError(t, server.Verify(mockhttp.Request().GET("/job"), mockhttp.Times(4)))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, server.WaitForN(ctx, mockhttp.Request().GET("/job"), 1))
+}
+
+func TestServer_WaitForRequest(t *testing.T) {
+	server := mockhttp.StartServer()
+	defer server.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		for _, body := range []string{"first", "second"} {
+			res, err := http.Post(server.BaseUrl()+"/jobs", "text/plain", strings.NewReader(body))
+			require.NoError(t, err)
+			_ = res.Body.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	request, err := server.WaitForRequest(ctx, mockhttp.Request().POST("/jobs").BodyString("second"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/jobs", request.Path, "unexpected path of waited request")
+		assert.Equal(t, "second", request.BodyAsString(), "unexpected body of waited request")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = server.WaitForRequest(ctx, mockhttp.Request())
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestServer_Requests(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().POST("/jobs")).
+			Respond(mockhttp.Response().StatusCode(http.StatusAccepted))))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := server.Requests(ctx, mockhttp.Request().Path("/jobs"))
+	go func() {
+		for _, body := range []string{"first", "second"} {
+			res, err := http.Post(server.BaseUrl()+"/jobs", "text/plain", strings.NewReader(body))
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			assertGetReturns(t, server.BaseUrl()+"/other", http.StatusNotFound, anyResponseBody)
+		}
+		res, err := http.Post(server.BaseUrl()+"/jobs", "text/plain", strings.NewReader("last"))
+		require.NoError(t, err)
+		_ = res.Body.Close()
+	}()
+
+	bodies := []string{}
+	for request := range requests {
+		bodies = append(bodies, request.BodyAsString())
+		if request.BodyAsString() == "last" {
+			cancel()
+		}
+	}
+	assert.Equal(t, []string{"first", "second", "last"}, bodies, "unexpected streamed requests")
+}
+
+func TestServer_RecordedRequestDetails(t *testing.T) {
+	endpoint := mockhttp.NewServerEndpoint().
+		When(mockhttp.Request().POST("/items/a/b")).
+		Respond(mockhttp.Response().Delay(50 * time.Millisecond))
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(mockhttp.NewServerEndpoint().When(mockhttp.Request().GET("/"))), mockhttp.WithTls(&tls.Config{}))
+	defer server.Close()
+	endpointID := server.AddEndpoint(endpoint)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	start := time.Now()
+	res, err := client.Post(server.BaseUrl()+"/items/a%2Fb?q=1", "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	res, err = client.Get(server.BaseUrl() + "/unmatched")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	accepted := server.AcceptedRequests()
+	require.Equal(t, 1, len(accepted), "unexpected number of accepted requests")
+	request := accepted[0]
+	assert.Equal(t, "/items/a/b", request.Path, "unexpected path")
+	assert.Equal(t, "/items/a%2Fb", request.RawPath, "unexpected raw path")
+	assert.Equal(t, "/items/a%2Fb?q=1", request.RequestURI, "unexpected request URI")
+	assert.Equal(t, fmt.Sprintf("localhost:%d", server.Port), request.Host, "unexpected host")
+	assert.Equal(t, "HTTP/1.1", request.Proto, "unexpected protocol")
+	assert.Equal(t, int64(5), request.ContentLength, "unexpected content length")
+	assert.Regexp(t, regexp.MustCompile(`^127\.0\.0\.1:\d+$`), request.RemoteAddr, "unexpected remote address")
+	if assert.NotNil(t, request.TLS, "expected TLS connection state") {
+		assert.True(t, request.TLS.HandshakeComplete, "expected TLS handshake to be complete")
+		assert.NotZero(t, request.TLS.Version, "expected negotiated TLS version")
+	}
+	assert.True(t, !request.ReceivedAt.Before(start) && !request.ReceivedAt.After(time.Now()), "unexpected receive time: %v", request.ReceivedAt)
+	assertDurationBetween(t, request.Duration, 50*time.Millisecond, 250*time.Millisecond, "unexpected handling duration")
+	assert.Equal(t, endpointID, request.EndpointID, "unexpected endpoint ID")
+
+	unmatched := server.UnmatchedRequests()
+	require.Equal(t, 1, len(unmatched), "unexpected number of unmatched requests")
+	assert.Zero(t, unmatched[0].EndpointID, "unexpected endpoint ID for unmatched request")
+	assert.Equal(t, int64(0), unmatched[0].ContentLength, "unexpected content length for unmatched request")
+}
+
+func TestServer_RecordedResponse(t *testing.T) {
+	server := mockhttp.StartServer(
+		mockhttp.WithResponseBodyLimit(5),
+		mockhttp.WithEndpoints(
+			mockhttp.NewServerEndpoint().
+				When(mockhttp.Request().GET("/dynamic")).
+				HandleWith(func(response http.ResponseWriter, request *http.Request) {
+					response.Header().Set("X-Request", request.URL.Query().Get("id"))
+					response.WriteHeader(http.StatusAccepted)
+					_, _ = response.Write([]byte("hello world"))
+				}),
+			mockhttp.NewServerEndpoint().
+				When(mockhttp.Request().GET("/empty")).
+				HandleWith(func(response http.ResponseWriter, request *http.Request) {})))
+	defer server.Close()
+
+	assertGetReturns(t, server.BaseUrl()+"/dynamic?id=42", http.StatusAccepted, "hello world")
+	assertGetReturns(t, server.BaseUrl()+"/empty", http.StatusOK, "")
+	assertGetReturns(t, server.BaseUrl()+"/unmatched", http.StatusNotFound, anyResponseBody)
+
+	accepted := server.AcceptedRequests()
+	require.Equal(t, 2, len(accepted), "unexpected number of accepted requests")
+	response := accepted[0].Response
+	if assert.NotNil(t, response, "expected response to be recorded") {
+		assert.Equal(t, http.StatusAccepted, response.StatusCode, "unexpected recorded status code")
+		assert.Equal(t, "42", response.Header.Get("X-Request"), "unexpected recorded header")
+		assert.Equal(t, "hello", response.BodyAsString(), "unexpected recorded body")
+		assert.True(t, response.BodyTruncated, "expected recorded body to be truncated")
+		assert.Equal(t, int64(11), response.BodySize, "unexpected recorded body size")
+		assert.False(t, response.SentAt.Before(accepted[0].ReceivedAt), "expected response to be sent after request was received")
+	}
+	if assert.NotNil(t, accepted[1].Response, "expected response to be recorded") {
+		assert.Equal(t, http.StatusOK, accepted[1].Response.StatusCode, "unexpected recorded status code")
+		assert.Equal(t, int64(0), accepted[1].Response.BodySize, "unexpected recorded body size")
+	}
+	unmatched := server.UnmatchedRequests()
+	require.Equal(t, 1, len(unmatched), "unexpected number of unmatched requests")
+	if assert.NotNil(t, unmatched[0].Response, "expected response to be recorded") {
+		assert.Equal(t, http.StatusNotFound, unmatched[0].Response.StatusCode, "unexpected recorded status code")
+		assert.Equal(t, "text/plain", unmatched[0].Response.Header.Get("Content-Type"), "unexpected recorded header")
+	}
+}
+
+func TestServer_ExportHAR(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/foo")).
+			Respond(mockhttp.Response().BodyString("hello"))))
+	defer server.Close()
+
+	assertGetReturns(t, server.BaseUrl()+"/foo?id=1", http.StatusOK, "hello")
+	assertGetReturns(t, server.BaseUrl()+"/bar", http.StatusNotFound, anyResponseBody)
+
+	b := strings.Builder{}
+	require.NoError(t, server.ExportHAR(&b))
+	var har struct {
+		Log struct {
+			Version string
+			Entries []struct {
+				Request struct {
+					Method string
+					URL    string
+				}
+				Response struct {
+					Status  int
+					Content struct {
+						Text string
+					}
+				}
+				Comment string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(b.String()), &har), "expected valid JSON")
+	assert.Equal(t, "1.2", har.Log.Version, "unexpected HAR version")
+	require.Equal(t, 2, len(har.Log.Entries), "unexpected number of entries")
+	assert.Equal(t, "GET", har.Log.Entries[0].Request.Method, "unexpected method of 1st entry")
+	assert.Equal(t, server.BaseUrl()+"/foo?id=1", har.Log.Entries[0].Request.URL, "unexpected URL of 1st entry")
+	assert.Equal(t, http.StatusOK, har.Log.Entries[0].Response.Status, "unexpected status of 1st entry")
+	assert.Equal(t, "hello", har.Log.Entries[0].Response.Content.Text, "unexpected content of 1st entry")
+	assert.Equal(t, server.BaseUrl()+"/bar", har.Log.Entries[1].Request.URL, "unexpected URL of 2nd entry")
+	assert.Equal(t, http.StatusNotFound, har.Log.Entries[1].Response.Status, "unexpected status of 2nd entry")
+	assert.Equal(t, "unmatched request", har.Log.Entries[1].Comment, "unexpected comment of 2nd entry")
+}
+
+func TestServer_Faults(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/close")).
+			Respond(mockhttp.Response().Fault(mockhttp.CloseConnection())),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/reset")).
+			Respond(mockhttp.Response().Fault(mockhttp.ResetConnection())),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/truncated")).
+			Respond(mockhttp.Response().Header("X-Foo", "foo").BodyString("hello world").Fault(mockhttp.TruncateBody(4))),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/truncated-chunked")).
+			Respond(mockhttp.Response().BodyString("hello world").Fault(mockhttp.TruncateChunkedBody(4))),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/malformed")).
+			Respond(mockhttp.Response().Fault(mockhttp.MalformedStatusLine())),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/body-read-error")).
+			Respond(mockhttp.Response().BodyString("hello world").BodyReadError(6, nil)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/raw")).
+			Respond(mockhttp.Response().Fault(mockhttp.RawBytes([]byte("garbage\r\n\r\n"))))))
+	defer server.Close()
+	// a new connection for each request, so the client does not retry requests on reused connections
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	_, err := client.Get(server.BaseUrl() + "/close")
+	assertErrorMatches(t, err, regexp.MustCompile("EOF"))
+
+	_, err = client.Get(server.BaseUrl() + "/reset")
+	if assert.Error(t, err) {
+		assert.True(t, errors.Is(err, syscall.ECONNRESET), "expected connection reset error, got: %v", err)
+	}
+
+	res, err := client.Get(server.BaseUrl() + "/truncated")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, res.StatusCode, "unexpected status code")
+		assert.Equal(t, "foo", res.Header.Get("X-Foo"), "unexpected header")
+		assert.Equal(t, int64(11), res.ContentLength, "unexpected content length")
+		body, err := ioutil.ReadAll(res.Body)
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "unexpected error reading truncated body")
+		assert.Equal(t, "hell", string(body), "unexpected truncated body")
+		_ = res.Body.Close()
+	}
+
+	res, err = client.Get(server.BaseUrl() + "/truncated-chunked")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"chunked"}, res.TransferEncoding, "unexpected transfer encoding")
+		body, err := ioutil.ReadAll(res.Body)
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "unexpected error reading truncated chunked body")
+		assert.Equal(t, "hell", string(body), "unexpected truncated chunked body")
+		_ = res.Body.Close()
+	}
+
+	res, err = client.Get(server.BaseUrl() + "/body-read-error")
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(res.Body)
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "unexpected error reading body")
+		assert.Equal(t, "hello ", string(body), "unexpected body read before the error")
+		_ = res.Body.Close()
+	}
+
+	_, err = client.Get(server.BaseUrl() + "/malformed")
+	assertErrorMatches(t, err, regexp.MustCompile("malformed HTTP status code"))
+
+	_, err = client.Get(server.BaseUrl() + "/raw")
+	assertErrorMatches(t, err, regexp.MustCompile("malformed HTTP response"))
+
+	assert.NoError(t, server.Verify(mockhttp.Request().GET("/close"), mockhttp.Once()))
+	accepted := server.AcceptedRequests()
+	require.Equal(t, 7, len(accepted), "unexpected number of accepted requests")
+	if assert.NotNil(t, accepted[0].Response, "expected response to be recorded") {
+		assert.Equal(t, 0, accepted[0].Response.StatusCode, "expected no status code to be recorded for a fault")
+	}
+}
+
+func TestServer_DelayAbortedWhenClientDisconnects(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/slow")).
+			Respond(mockhttp.Response().Delay(time.Minute))))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.BaseUrl()+"/slow", nil)
+	require.NoError(t, err)
+	_, err = http.DefaultClient.Do(req)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded error, got: %v", err)
+
+	// the handler returns (and the response is recorded) once the delay is aborted
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if requests := server.AcceptedRequests(); len(requests) == 1 && requests[0].Response != nil {
+			assertDurationBetween(t, requests[0].Duration, 0, 500*time.Millisecond, "expected delay to be aborted")
+			assert.Equal(t, 0, requests[0].Response.StatusCode, "expected no status code to be recorded for an aborted request")
+			assert.True(t, errors.Is(requests[0].Response.Error, context.Canceled), "expected aborted request to be recorded, got: %v", requests[0].Response.Error)
+			har := strings.Builder{}
+			require.NoError(t, server.ExportHAR(&har))
+			assert.Contains(t, har.String(), `"status": 0,`, "expected no status in HAR")
+			assert.Contains(t, har.String(), `"_error": "context canceled"`, "expected aborted request in HAR")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Fail(t, "expected delay to be aborted when the client disconnects")
+}
+
+func TestServer_Transport(t *testing.T) {
+	server := mockhttp.NewServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().POST("/foo")).
+			Respond(mockhttp.Response().StatusCode(201).BodyString("created")),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/slow")).
+			Respond(mockhttp.Response().Delay(time.Minute))))
+	defer server.Close()
+	assert.Equal(t, "http://localhost", server.BaseUrl(), "unexpected base URL of a server which was not started")
+	client := &http.Client{Transport: server.Transport()}
+
+	res, err := client.Post(server.BuildUrl("/foo?bar=baz"), "text/plain", strings.NewReader("hello"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "201 Created", res.Status, "unexpected status")
+		assert.Equal(t, int64(7), res.ContentLength, "unexpected content length")
+		assert.Equal(t, "created", string(mockhttp.MustReadAll(t, res.Body)), "unexpected body")
+	}
+
+	res, err = client.Get("https://otherhost/bar")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "unexpected status code")
+		assert.Equal(t, "404 page not found", string(mockhttp.MustReadAll(t, res.Body)), "unexpected body")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.BuildUrl("/slow"), nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded error, got: %v", err)
+
+	accepted := server.AcceptedRequests()
+	if assert.Equal(t, 2, len(accepted), "unexpected number of accepted requests") {
+		request := accepted[0]
+		assert.Equal(t, "localhost", request.Host, "unexpected host")
+		assert.Equal(t, "/foo?bar=baz", request.RequestURI, "unexpected request URI")
+		assert.Equal(t, "hello", request.BodyAsString(), "unexpected body")
+		assert.Equal(t, int64(5), request.ContentLength, "unexpected content length")
+		assert.Equal(t, "HTTP/1.1", request.Proto, "unexpected proto")
+		assert.Equal(t, "127.0.0.1:0", request.RemoteAddr, "unexpected remote address")
+		if assert.NotNil(t, request.Response, "expected response to be recorded") {
+			assert.Equal(t, 201, request.Response.StatusCode, "unexpected recorded status code")
+			assert.Equal(t, "created", request.Response.BodyAsString(), "unexpected recorded body")
+		}
+		// the canceled request is complete once the transport returns
+		if assert.NotNil(t, accepted[1].Response, "expected aborted request to be complete") {
+			assert.True(t, errors.Is(accepted[1].Response.Error, context.DeadlineExceeded), "expected aborted request to be recorded, got: %v", accepted[1].Response.Error)
+		}
+	}
+	unmatched := server.UnmatchedRequests()
+	if assert.Equal(t, 1, len(unmatched), "unexpected number of unmatched requests") {
+		assert.Equal(t, "https", unmatched[0].Scheme, "unexpected scheme")
+		if assert.NotNil(t, unmatched[0].TLS, "expected TLS connection state") {
+			assert.Equal(t, "otherhost", unmatched[0].TLS.ServerName, "unexpected TLS server name")
+		}
+	}
+}
+
+func TestServer_TransportSameAsServer(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/html")).
+			Respond(mockhttp.Response().BodyString("<html><body>hello</body></html>")),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/json")).
+			Respond(mockhttp.Response().Header("Content-Type", "application/json").BodyString(`{"foo":"bar"}`)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/no-content")).
+			Respond(mockhttp.Response().StatusCode(204)),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/truncated")).
+			Respond(mockhttp.Response().BodyString("hello world").Fault(mockhttp.TruncateBody(4))),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/truncated-chunked")).
+			Respond(mockhttp.Response().BodyString("hello world").Fault(mockhttp.TruncateChunkedBody(4))),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/flushed")).
+			HandleWith(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("hello "))
+				w.(http.Flusher).Flush()
+				_, _ = w.Write([]byte("world"))
+			})))
+	defer server.Close()
+	socketClient := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	inMemoryClient := &http.Client{Transport: server.Transport()}
+
+	for _, path := range []string{"/html", "/json", "/no-content", "/truncated", "/truncated-chunked", "/flushed", "/unmatched"} {
+		t.Run(path, func(t *testing.T) {
+			expected, err := socketClient.Get(server.BuildUrl(path))
+			require.NoError(t, err)
+			actual, err := inMemoryClient.Get(server.BuildUrl(path))
+			require.NoError(t, err)
+			assert.Equal(t, expected.Status, actual.Status, "unexpected status")
+			assert.Equal(t, expected.ContentLength, actual.ContentLength, "unexpected content length")
+			assert.Equal(t, expected.TransferEncoding, actual.TransferEncoding, "unexpected transfer encoding")
+			for _, name := range []string{"Content-Type", "Content-Length"} {
+				assert.Equal(t, expected.Header.Values(name), actual.Header.Values(name), "unexpected %s header", name)
+			}
+			assert.Equal(t, expected.Header.Get("Date") != "", actual.Header.Get("Date") != "", "unexpected Date header")
+			expectedBody, expectedErr := ioutil.ReadAll(expected.Body)
+			actualBody, actualErr := ioutil.ReadAll(actual.Body)
+			assert.Equal(t, string(expectedBody), string(actualBody), "unexpected body")
+			assert.Equal(t, expectedErr, actualErr, "unexpected error reading body")
+			_ = expected.Body.Close()
+			_ = actual.Body.Close()
+		})
+	}
+}
+
+func TestServer_TransportStreaming(t *testing.T) {
+	server := mockhttp.StartServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/events")).
+			HandleWith(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("first\n"))
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			})))
+	defer server.Close()
+	clients := map[string]*http.Client{
+		"socket":    {Transport: &http.Transport{DisableKeepAlives: true}},
+		"in-memory": {Transport: server.Transport()},
+	}
+
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, "GET", server.BuildUrl("/events"), nil)
+			require.NoError(t, err)
+			start := time.Now()
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"chunked"}, res.TransferEncoding, "unexpected transfer encoding")
+			line, err := bufio.NewReader(res.Body).ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, "first\n", line, "unexpected first line")
+			assert.True(t, time.Since(start) < time.Second, "expected the first line before the handler returns, took: %v", time.Since(start))
+			assert.NoError(t, res.Body.Close())
+		})
+	}
+
+	// the in-memory request is complete once the body is closed, as the handler returns when the client goes away
+	accepted := server.AcceptedRequests()
+	if assert.Equal(t, 2, len(accepted), "unexpected number of accepted requests") {
+		for _, request := range accepted {
+			if request.RemoteAddr == "127.0.0.1:0" && assert.NotNil(t, request.Response, "expected request to be complete") {
+				assert.Equal(t, "first\n", request.Response.BodyAsString(), "unexpected recorded body")
+			}
+		}
+	}
+}
+
+func TestServer_TransportFaults(t *testing.T) {
+	server := mockhttp.NewServer(mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/close")).
+			Respond(mockhttp.Response().Fault(mockhttp.CloseConnection())),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/reset")).
+			Respond(mockhttp.Response().Fault(mockhttp.ResetConnection())),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/truncated")).
+			Respond(mockhttp.Response().BodyString("hello world").Fault(mockhttp.TruncateBody(4))),
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/malformed")).
+			Respond(mockhttp.Response().Fault(mockhttp.MalformedStatusLine()))))
+	client := &http.Client{Transport: server.Transport()}
+
+	_, err := client.Get(server.BuildUrl("/close"))
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "expected unexpected EOF error, got: %v", err)
+
+	_, err = client.Get(server.BuildUrl("/reset"))
+	assert.True(t, errors.Is(err, syscall.ECONNRESET), "expected connection reset error, got: %v", err)
+
+	res, err := client.Get(server.BuildUrl("/truncated"))
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(res.Body)
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "unexpected error reading truncated body")
+		assert.Equal(t, "hell", string(body), "unexpected truncated body")
+		_ = res.Body.Close()
+		// the request is complete once the body is closed
+		accepted := server.AcceptedRequests()
+		assert.NotNil(t, accepted[len(accepted)-1].Response, "expected request to be complete")
+	}
+
+	_, err = client.Get(server.BuildUrl("/malformed"))
+	assertErrorMatches(t, err, regexp.MustCompile("malformed HTTP status code"))
+
+	assert.NoError(t, server.Verify(mockhttp.Request().GET("/close"), mockhttp.Once()))
+}
+
 func assertDurationBetween(t *testing.T, duration time.Duration, min time.Duration, max time.Duration, msg string, args ...interface{}) bool {
 	if duration < min || duration > max {
 		return assert.Failf(t, fmt.Sprintf("Duration not in range: \n"+
@@ -0,0 +1,342 @@
+package mockhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inMemoryRemoteAddr is the remote address of requests sent to a mock server via its transport
+const inMemoryRemoteAddr = "127.0.0.1:0"
+
+// serverTransport is an http.RoundTripper which dispatches requests to the endpoints of a mock server in memory (see
+// the server's Transport function)
+type serverTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip returns once the handler returns, hijacks the connection or flushes the response (streaming the rest of the
+// body), so unless the response is streamed the request is complete in the recorder of the server by then. When the
+// request context is done, the handler is expected to return as well (as the endpoints do, e.g. while waiting for a
+// delayed response).
+func (t *serverTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	serverRequest, err := newServerRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	// like the net/http server, the request context is canceled once the handler returns, or the client closes the body
+	// of a streamed response (see streamBody)
+	ctx, cancel := context.WithCancel(serverRequest.Context())
+	serverRequest = serverRequest.WithContext(ctx)
+	w := newInMemoryResponseWriter()
+	handled := make(chan struct{})
+	var panicked interface{}
+	go func() {
+		defer close(handled)
+		defer cancel()
+		defer func() {
+			panicked = recover()
+			w.closeStream(panicked != nil)
+		}()
+		t.handler.ServeHTTP(w, serverRequest)
+	}()
+
+	select {
+	case <-handled:
+	case <-w.hijacked:
+		return readHijackedResponse(w.clientConn, request, handled)
+	case <-w.flushed:
+		return w.streamedResponse(request, handled, cancel), nil
+	}
+	if w.streamReader != nil {
+		// flushed, and the handler already returned
+		return w.streamedResponse(request, handled, cancel), nil
+	}
+	if panicked != nil {
+		return nil, fmt.Errorf("mock server handler panicked: %v", panicked)
+	}
+	if w.clientConn != nil {
+		// hijacked, and the handler already returned
+		return readHijackedResponse(w.clientConn, request, handled)
+	}
+	if err := request.Context().Err(); err != nil {
+		// the handler gave up waiting (e.g. a delayed response), because the request was canceled
+		return nil, err
+	}
+	return w.response(request), nil
+}
+
+// newServerRequest creates the request received by a server for the given client request, the same way the net/http
+// transport sends it and the net/http server reads it. The body of the given request is read and closed.
+func newServerRequest(request *http.Request) (*http.Request, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read request body: %v", err)
+		}
+	}
+	requestURI := request.URL.RequestURI()
+	u, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse request URI '%s': %v", requestURI, err)
+	}
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+
+	header := request.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if _, ok := header["User-Agent"]; !ok {
+		header.Set("User-Agent", "Go-http-client/1.1")
+	}
+	serverRequest := &http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       http.NoBody,
+		Host:       host,
+		RemoteAddr: inMemoryRemoteAddr,
+		RequestURI: requestURI,
+	}
+	if len(body) > 0 {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		serverRequest.Body = ioutil.NopCloser(bytes.NewReader(body))
+		serverRequest.ContentLength = int64(len(body))
+	}
+	if request.URL.Scheme == "https" {
+		serverRequest.TLS = &tls.ConnectionState{
+			Version:           tls.VersionTLS13,
+			HandshakeComplete: true,
+			ServerName:        request.URL.Hostname(),
+		}
+	}
+	return serverRequest.WithContext(request.Context()), nil
+}
+
+// inMemoryResponseWriter buffers the response written by a handler, like httptest.ResponseRecorder. Flushing the
+// response sends it to the client, and streams the rest of the body through an in-memory pipe. Hijacking the
+// connection gives the handler one end of an in-memory connection, which the transport reads the raw response from.
+type inMemoryResponseWriter struct {
+	header       http.Header
+	statusCode   int
+	sentHeader   http.Header
+	body         bytes.Buffer
+	flushOnce    sync.Once
+	flushed      chan struct{}
+	streamReader *io.PipeReader
+	stream       *io.PipeWriter
+	hijackOnce   sync.Once
+	hijacked     chan struct{}
+	clientConn   net.Conn
+}
+
+func newInMemoryResponseWriter() *inMemoryResponseWriter {
+	return &inMemoryResponseWriter{
+		header:   http.Header{},
+		flushed:  make(chan struct{}),
+		hijacked: make(chan struct{}),
+	}
+}
+
+func (w *inMemoryResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *inMemoryResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+		w.sentHeader = w.header.Clone()
+	}
+}
+
+func (w *inMemoryResponseWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !bodyAllowedForStatus(w.statusCode) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	if w.stream != nil {
+		// blocks until the client reads the data, fails once the client closed the body
+		return w.stream.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+// Flush sends the response to the client, the rest of the body is streamed as it is written
+func (w *inMemoryResponseWriter) Flush() {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.flushOnce.Do(func() {
+		w.streamReader, w.stream = io.Pipe()
+		close(w.flushed)
+	})
+}
+
+// closeStream ends the streamed body (if the response was flushed) once the handler returned. The client gets an
+// unexpected EOF error if the handler panicked, like when the net/http server aborts the connection.
+func (w *inMemoryResponseWriter) closeStream(aborted bool) {
+	if w.stream == nil {
+		return
+	}
+	if aborted {
+		w.stream.CloseWithError(io.ErrUnexpectedEOF)
+	} else {
+		w.stream.Close()
+	}
+}
+
+func (w *inMemoryResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	err := http.ErrHijacked
+	var serverConn net.Conn
+	w.hijackOnce.Do(func() {
+		serverConn, w.clientConn = newInMemoryConn()
+		close(w.hijacked)
+		err = nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return serverConn, bufio.NewReadWriter(bufio.NewReader(serverConn), bufio.NewWriter(serverConn)), nil
+}
+
+// response returns the buffered response, with the headers the net/http server would add
+func (w *inMemoryResponseWriter) response(request *http.Request) *http.Response {
+	return newClientResponse(request, w.statusCode, w.responseHeader(), w.body.Bytes(), nil)
+}
+
+// streamedResponse returns the flushed response, its body is read from the stream. Like the net/http server, the body
+// is chunked unless the handler set the Content-Length header.
+func (w *inMemoryResponseWriter) streamedResponse(request *http.Request, handled <-chan struct{}, cancel context.CancelFunc) *http.Response {
+	header := w.responseHeader()
+	if header.Get("Content-Length") == "" && bodyAllowedForStatus(w.statusCode) {
+		header.Set("Transfer-Encoding", "chunked")
+	}
+	res := newClientResponse(request, w.statusCode, header, nil, io.MultiReader(bytes.NewReader(w.body.Bytes()), w.streamReader))
+	if res.Body == http.NoBody {
+		// e.g. a HEAD request, the body written by the handler is discarded
+		go io.Copy(ioutil.Discard, w.streamReader)
+		return res
+	}
+	res.Body = &streamBody{ReadCloser: res.Body, stream: w.streamReader, cancel: cancel, handled: handled}
+	return res
+}
+
+// responseHeader returns the header sent by the handler, with the headers the net/http server would add
+func (w *inMemoryResponseWriter) responseHeader() http.Header {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	header := w.sentHeader
+	if _, ok := header["Date"]; !ok {
+		header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	_, hasType := header["Content-Type"]
+	if !hasType && header.Get("Content-Encoding") == "" && header.Get("Transfer-Encoding") == "" && w.body.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.body.Bytes()))
+	}
+	return header
+}
+
+// streamBody is the body of a streamed response. Closing it fails further writes of the handler, cancels the request
+// context, and waits for the handler to return, so the request is complete in the recorder of the server by then.
+type streamBody struct {
+	io.ReadCloser
+	stream  *io.PipeReader
+	cancel  context.CancelFunc
+	handled <-chan struct{}
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.stream.Close()
+	b.cancel()
+	<-b.handled
+	return err
+}
+
+// readHijackedResponse reads the response written by a handler which hijacked the connection (e.g. to inject a fault).
+// Once the connection is closed, waits for the handler to return (see connBody).
+func readHijackedResponse(conn net.Conn, request *http.Request, handled <-chan struct{}) (*http.Response, error) {
+	res, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		conn.Close()
+		<-handled
+		if err == io.EOF {
+			// the connection was closed before a response was sent
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	res.Body = &connBody{ReadCloser: res.Body, conn: conn, handled: handled}
+	return res, nil
+}
+
+// connBody closes the connection a response body is read from when the body is closed, and waits for the handler to
+// return, so the request is complete in the recorder of the server by then. Closing the connection fails further
+// writes of the handler, if any.
+type connBody struct {
+	io.ReadCloser
+	conn    net.Conn
+	handled <-chan struct{}
+}
+
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	<-b.handled
+	return err
+}
+
+// inMemoryConn is an end of an in-memory connection (see net.Pipe), given to a handler which hijacks the connection
+type inMemoryConn struct {
+	net.Conn
+	// reset is shared by both ends of the connection, set when the connection is reset
+	reset *int32
+}
+
+func newInMemoryConn() (serverConn net.Conn, clientConn net.Conn) {
+	reset := new(int32)
+	server, client := net.Pipe()
+	return &inMemoryConn{Conn: server, reset: reset}, &inMemoryConn{Conn: client, reset: reset}
+}
+
+// Read returns a connection reset error instead of the error of the pipe (e.g. io.EOF) once the connection was reset
+func (c *inMemoryConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil && atomic.LoadInt32(c.reset) == 1 {
+		return n, ConnectionReset()
+	}
+	return n, err
+}
+
+// resetOnClose makes the connection act as reset (instead of closed) once it is closed, like a TCP connection with
+// linger 0 (see ResetConnection)
+func (c *inMemoryConn) resetOnClose() {
+	atomic.StoreInt32(c.reset, 1)
+}
@@ -0,0 +1,53 @@
+package mockhttp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// WithUnmatchedRequestsAllowed disables the strict check of a test server (see NewTestServer), which fails the test if
+// the server received requests that did not match any of its endpoints.
+//
+// Has no effect on servers started with StartServer.
+func WithUnmatchedRequestsAllowed() ServerOpt {
+	return func(s *Server) {
+		s.allowUnmatched = true
+	}
+}
+
+// NewTestServer starts a new mock http server bound to the given test. The server is configured using the provided
+// functional options, the same as StartServer.
+//
+// The server is closed automatically when the test (and all its subtests) completes. Before closing, the test fails if
+// the server received requests which did not match any of its endpoints (unless WithUnmatchedRequestsAllowed is set),
+// or if expectations declared on its endpoints were not met (see VerifyExpectations).
+//
+// For example:
+//   server := NewTestServer(t, WithEndpoints(
+//   	NewServerEndpoint().When(Request().GET("/foo")).Respond(Response())))
+//   // no need to close the server, use it in the test...
+func NewTestServer(t testing.TB, opts ...ServerOpt) *Server {
+	t.Helper()
+	server := StartServer(opts...)
+	t.Cleanup(func() {
+		defer server.Close()
+		if !server.allowUnmatched {
+			if unmatched := server.UnmatchedRequests(); len(unmatched) > 0 {
+				t.Errorf("mock server '%s' received %d unmatched requests:\n%s", server.name, len(unmatched), requestsToString(unmatched))
+			}
+		}
+		if err := server.VerifyExpectations(); err != nil {
+			t.Errorf("mock server '%s': %v", server.name, err)
+		}
+	})
+	return server
+}
+
+func requestsToString(requests []RecordedRequest) string {
+	b := strings.Builder{}
+	for i, req := range requests {
+		b.WriteString(fmt.Sprintf("%2d: %s", i+1, req))
+	}
+	return b.String()
+}
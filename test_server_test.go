@@ -0,0 +1,79 @@
+package mockhttp_test
+
+import (
+	"fmt"
+	"github.com/jfrog/go-mockhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestNewTestServer(t *testing.T) {
+	server := mockhttp.NewTestServer(t, mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().
+			When(mockhttp.Request().GET("/foo")).
+			Respond(mockhttp.Response().BodyString("foo"))))
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "foo")
+}
+
+func TestNewTestServer_ClosedOnCleanup(t *testing.T) {
+	fakeTest := &fakeT{}
+	server := mockhttp.NewTestServer(fakeTest)
+	fakeTest.runCleanups()
+	_, err := http.Get(server.BuildUrl("/foo"))
+	assert.Error(t, err, "server was expected to be closed")
+	assert.Empty(t, fakeTest.errors, "test was not expected to fail")
+}
+
+func TestNewTestServer_StrictUnmatchedRequests(t *testing.T) {
+	fakeTest := &fakeT{}
+	server := mockhttp.NewTestServer(fakeTest, mockhttp.WithName("strict"), mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().GET("/foo"))))
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "")
+	assertGetReturns(t, server.BuildUrl("/bar"), http.StatusNotFound, anyResponseBody)
+	fakeTest.runCleanups()
+	require.Equal(t, 1, len(fakeTest.errors), "test was expected to fail")
+	assert.Regexp(t, `mock server 'strict' received 1 unmatched requests:\n 1: GET /bar`, fakeTest.errors[0])
+}
+
+func TestNewTestServer_UnmatchedRequestsAllowed(t *testing.T) {
+	fakeTest := &fakeT{}
+	server := mockhttp.NewTestServer(fakeTest, mockhttp.WithUnmatchedRequestsAllowed())
+	assertGetReturns(t, server.BuildUrl("/bar"), http.StatusNotFound, anyResponseBody)
+	fakeTest.runCleanups()
+	assert.Empty(t, fakeTest.errors, "test was not expected to fail")
+}
+
+func TestNewTestServer_VerifyExpectations(t *testing.T) {
+	fakeTest := &fakeT{}
+	server := mockhttp.NewTestServer(fakeTest, mockhttp.WithName("expectations"), mockhttp.WithEndpoints(
+		mockhttp.NewServerEndpoint().When(mockhttp.Request().GET("/foo")).Expect(mockhttp.AtLeast(2))))
+	assertGetReturns(t, server.BuildUrl("/foo"), http.StatusOK, "")
+	fakeTest.runCleanups()
+	require.Equal(t, 1, len(fakeTest.errors), "test was expected to fail")
+	assert.Regexp(t, `mock server 'expectations': 1 endpoints did not meet their expectations:\n.*expected at least: 2, actual: 1`, fakeTest.errors[0])
+}
+
+// fakeT is a fake test, used for testing test helpers without failing the actual test
+type fakeT struct {
+	testing.TB
+	cleanups []func()
+	errors   []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Cleanup(cleanup func()) {
+	f.cleanups = append(f.cleanups, cleanup)
+}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) runCleanups() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
@@ -0,0 +1,113 @@
+package mockhttp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConnectionRefused creates an error of a connection refused by the remote host.
+//
+// This and the other transport error functions create errors shaped like the errors returned by the net/http
+// transport, to be returned by client endpoints (see ReturnError). Note that the errors do not include the address of
+// the remote host.
+func ConnectionRefused() error {
+	return &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}
+}
+
+// ConnectionReset creates an error of a connection reset by the remote host, while reading the response
+func ConnectionReset() error {
+	return &net.OpError{
+		Op:  "read",
+		Net: "tcp",
+		Err: os.NewSyscallError("read", syscall.ECONNRESET),
+	}
+}
+
+// DialTimeout creates an error of a timeout while connecting to the remote host. The error is a net.Error, and its
+// Timeout function returns true. Like the error of a real dial timeout, it is a context.DeadlineExceeded error (see
+// errors.Is), and not an os.ErrDeadlineExceeded error.
+func DialTimeout() error {
+	return &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: &timeoutError{},
+	}
+}
+
+// timeoutError is the error of a dial timeout, the same as the (unexported) error returned by the net package
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func (e *timeoutError) Is(err error) bool {
+	return err == context.DeadlineExceeded
+}
+
+// DNSNotFound creates an error of a DNS lookup failure, when the given host is not found
+func DNSNotFound(host string) error {
+	return &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: &net.DNSError{
+			Err:        "no such host",
+			Name:       host,
+			IsNotFound: true,
+		},
+	}
+}
+
+// TLSUnknownAuthority creates an error of a TLS handshake failure, when the certificate of the remote host is signed by
+// an unknown authority. The error holds a self-signed certificate, as the one presented by the remote host, and is
+// wrapped the same way the net/http transport wraps certificate verification errors (as *tls.CertificateVerificationError
+// since Go 1.20). Like any error returned by the transport, the http.Client wraps it in *url.Error.
+func TLSUnknownAuthority() error {
+	cert := unknownAuthorityCertificate()
+	return certificateVerificationError(cert, x509.UnknownAuthorityError{Cert: cert})
+}
+
+var unknownAuthorityCert struct {
+	once sync.Once
+	cert *x509.Certificate
+}
+
+// unknownAuthorityCertificate returns a self-signed certificate, generated once
+func unknownAuthorityCertificate() *x509.Certificate {
+	unknownAuthorityCert.once.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(fmt.Errorf("could not generate certificate key: %v", err))
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "mockhttp"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			DNSNames:     []string{"mockhttp"},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			panic(fmt.Errorf("could not generate certificate: %v", err))
+		}
+		if unknownAuthorityCert.cert, err = x509.ParseCertificate(der); err != nil {
+			panic(fmt.Errorf("could not parse generated certificate: %v", err))
+		}
+	})
+	return unknownAuthorityCert.cert
+}
@@ -0,0 +1,14 @@
+//go:build go1.20
+// +build go1.20
+
+package mockhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// certificateVerificationError wraps a certificate verification error the same way the TLS client does
+func certificateVerificationError(cert *x509.Certificate, err error) error {
+	return &tls.CertificateVerificationError{UnverifiedCertificates: []*x509.Certificate{cert}, Err: err}
+}
@@ -0,0 +1,14 @@
+//go:build !go1.20
+// +build !go1.20
+
+package mockhttp
+
+import (
+	"crypto/x509"
+)
+
+// certificateVerificationError returns a certificate verification error as is, the same way the TLS client does before
+// Go 1.20
+func certificateVerificationError(cert *x509.Certificate, err error) error {
+	return err
+}
@@ -1,7 +1,9 @@
 package mockhttp
 
 import (
+	"context"
 	"fmt"
+	"strings"
 )
 
 func newVerifier(matcher *requestMatcher, opts ...verifyOpt) *verifier {
@@ -21,30 +23,168 @@ type verifier struct {
 }
 
 func (v *verifier) verifyRequests(recorder *requestRecorder) error {
-	acceptedCount := v.countRequests(recorder.AcceptedRequests())
-	unmatchedCount := v.countRequests(recorder.UnmatchedRequests())
+	acceptedCount, unmatchedCount := 0, 0
+	matchedIDs := []uint64{}
+	for _, record := range recorder.timeline() {
+		if v.matcher.matches(record.request.toHttpRequest()) {
+			if record.accepted {
+				acceptedCount++
+			} else {
+				unmatchedCount++
+			}
+			matchedIDs = append(matchedIDs, record.id)
+		}
+	}
 	if err := v.verifyTimes(acceptedCount, unmatchedCount); err != nil {
 		return verifyError(fmt.Sprintf("%s\n%s", err, v.detailsStr(recorder)))
 	}
+	recorder.markVerified(matchedIDs...)
 	return nil
 }
 
-func (v *verifier) countRequests(requests []recordedRequest) int {
-	count := 0
-	for _, req := range requests {
-		if v.matcher.matches(req.toHttpRequest()) {
-			count++
-		}
-	}
-	return count
-}
-
 func (v *verifier) detailsStr(recorder *requestRecorder) string {
 	return fmt.Sprintf(""+
 		"expected: %s \n"+
 		"actual  : %s", v.matcher, recorder)
 }
 
+// waitFor waits for n requests matching the given matcher to be recorded, ignoring requests which were recorded before
+// the call. Returns the matching requests, in the order they were received, or the context's error if the context is
+// done first.
+//
+// Waiting is notified by the recorder whenever a request is recorded, and only newly recorded requests are evaluated.
+func waitFor(ctx context.Context, recorder *requestRecorder, matcher *requestMatcher, n int) ([]RecordedRequest, error) {
+	matched := []RecordedRequest{}
+	lastID := recorder.lastRecordID()
+	for len(matched) < n {
+		records, changed := recorder.recordsAfter(lastID)
+		for _, record := range records {
+			lastID = record.id
+			if matcher.matches(record.request.toHttpRequest()) {
+				matched = append(matched, record.request)
+				if len(matched) == n {
+					return matched, nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+	return matched, nil
+}
+
+// verifyInOrder verifies that the recorded requests include requests matching the given matchers, in the given order.
+// When strict, the matching requests must be consecutive (no other requests in between), otherwise other requests may
+// be interleaved.
+func verifyInOrder(recorder *requestRecorder, strict bool, matchers ...*requestMatcher) error {
+	timeline := recorder.timeline()
+	if len(matchers) == 0 {
+		return nil
+	}
+	if matchedIDs, ok := inOrder(timeline, strict, matchers); ok {
+		recorder.markVerified(matchedIDs...)
+		return nil
+	}
+
+	expected := strings.Builder{}
+	for i, matcher := range matchers {
+		expected.WriteString(fmt.Sprintf("  %2d: %s\n", i+1, matcher))
+	}
+	mode := "in order"
+	if strict {
+		mode = "in strict order (with no other requests in between)"
+	}
+	return verifyError(fmt.Sprintf(""+
+		"requests were not received %s\n"+
+		"expected:\n%s"+
+		"actual  :\n%s", mode, expected.String(), timelineString(timeline)))
+}
+
+// inOrder checks whether the timeline includes requests matching the given matchers in order, and returns the IDs of
+// the records matching the matchers
+func inOrder(timeline []requestRecord, strict bool, matchers []*requestMatcher) ([]uint64, bool) {
+	if strict {
+		for start := 0; start+len(matchers) <= len(timeline); start++ {
+			if records := timeline[start : start+len(matchers)]; matchesConsecutive(records, matchers) {
+				return recordIDs(records), true
+			}
+		}
+		return nil, false
+	}
+
+	matched := []requestRecord{}
+	for _, record := range timeline {
+		if matchers[len(matched)].matches(record.request.toHttpRequest()) {
+			matched = append(matched, record)
+			if len(matched) == len(matchers) {
+				return recordIDs(matched), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func matchesConsecutive(records []requestRecord, matchers []*requestMatcher) bool {
+	for i, matcher := range matchers {
+		if !matcher.matches(records[i].request.toHttpRequest()) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyNoMoreInteractions verifies that all recorded requests were already verified
+func verifyNoMoreInteractions(recorder *requestRecorder) error {
+	unverified := recorder.unverified()
+	if len(unverified) > 0 {
+		return verifyError(fmt.Sprintf("found %d unverified requests:\n%s", len(unverified), timelineString(unverified)))
+	}
+	return nil
+}
+
+// verifyCount verifies a number of requests according to the given verify options
+func verifyCount(count int, opts ...verifyOpt) error {
+	return newVerifier(Request(), opts...).verifyTimes(count, 0)
+}
+
+// expectationVerifier is implemented by endpoints which can declare expectations
+type expectationVerifier interface {
+	verifyExpectations() error
+}
+
+// noExpectations is the expectation verifier of a custom endpoint, which cannot declare expectations
+type noExpectations struct{}
+
+func (n noExpectations) verifyExpectations() error {
+	return nil
+}
+
+// expectationVerifierOf returns the expectation verifier of the given server or client endpoint
+func expectationVerifierOf(endpoint interface{}) expectationVerifier {
+	if verifier, ok := endpoint.(expectationVerifier); ok {
+		return verifier
+	}
+	return noExpectations{}
+}
+
+// verifyExpectations verifies the declared expectations of all given endpoints, and returns a single error listing
+// all endpoints which did not meet their expectations
+func verifyExpectations(endpoints []expectationVerifier) error {
+	failures := []string{}
+	for i, endpoint := range endpoints {
+		if err := endpoint.verifyExpectations(); err != nil {
+			failures = append(failures, fmt.Sprintf("  %2d: %v - %s", i+1, endpoint, err))
+		}
+	}
+	if len(failures) > 0 {
+		return verifyError(fmt.Sprintf("%d endpoints did not meet their expectations:\n%s", len(failures), strings.Join(failures, "\n")))
+	}
+	return nil
+}
+
 type verifyOpt func(verifier *verifier)
 
 // Times is a verify functional option to set how many times a request is expected
@@ -0,0 +1,187 @@
+package mockhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestVerifyInOrder(t *testing.T) {
+	recorder := newRequestRecorder()
+	for _, req := range []struct {
+		method   string
+		url      string
+		accepted bool
+	}{
+		{method: "POST", url: "http://host/session", accepted: true},
+		{method: "GET", url: "http://host/data?page=1", accepted: true},
+		{method: "GET", url: "http://host/other", accepted: false},
+		{method: "GET", url: "http://host/data?page=2", accepted: true},
+		{method: "DELETE", url: "http://host/session", accepted: true},
+	} {
+		httpRequest, err := http.NewRequest(req.method, req.url, nil)
+		require.NoError(t, err)
+		if req.accepted {
+			recorder.recordAcceptedRequest(httpRequest, time.Now(), 0, nil)
+		} else {
+			recorder.recordUnmatchedRequest(httpRequest, time.Now())
+		}
+	}
+
+	tests := []struct {
+		name       string
+		matchers   []*requestMatcher
+		wantOrder  bool
+		wantStrict bool
+	}{
+		{
+			name:       "no matchers",
+			matchers:   []*requestMatcher{},
+			wantOrder:  true,
+			wantStrict: true,
+		},
+		{
+			name:       "all requests",
+			matchers:   []*requestMatcher{Request().POST("/session"), Request().GET("/data"), Request().GET("/other"), Request().GET("/data"), Request().DELETE("/session")},
+			wantOrder:  true,
+			wantStrict: true,
+		},
+		{
+			name:       "with gaps",
+			matchers:   []*requestMatcher{Request().POST("/session"), Request().GET("/data").Query("page", "2"), Request().DELETE("/session")},
+			wantOrder:  true,
+			wantStrict: false,
+		},
+		{
+			name:       "consecutive",
+			matchers:   []*requestMatcher{Request().GET("/data").Query("page", "2"), Request().DELETE("/session")},
+			wantOrder:  true,
+			wantStrict: true,
+		},
+		{
+			name:       "consecutive including unmatched requests",
+			matchers:   []*requestMatcher{Request().GET("/data"), Request().GET("/other"), Request().GET("/data")},
+			wantOrder:  true,
+			wantStrict: true,
+		},
+		{
+			name:       "wrong order",
+			matchers:   []*requestMatcher{Request().DELETE("/session"), Request().GET("/data")},
+			wantOrder:  false,
+			wantStrict: false,
+		},
+		{
+			name:       "same request twice",
+			matchers:   []*requestMatcher{Request().POST("/session"), Request().POST("/session")},
+			wantOrder:  false,
+			wantStrict: false,
+		},
+		{
+			name:       "more matchers than requests",
+			matchers:   []*requestMatcher{Request(), Request(), Request(), Request(), Request(), Request()},
+			wantOrder:  false,
+			wantStrict: false,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.wantOrder, verifyInOrder(recorder, false, testCase.matchers...) == nil, "unexpected in order verification result")
+			assert.Equal(t, testCase.wantStrict, verifyInOrder(recorder, true, testCase.matchers...) == nil, "unexpected in strict order verification result")
+		})
+	}
+}
+
+func TestVerifyInOrder_Error(t *testing.T) {
+	recorder := newRequestRecorder()
+	req, err := http.NewRequest("GET", "http://host/data?page=1", nil)
+	require.NoError(t, err)
+	recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
+	req, err = http.NewRequest("POST", "http://host/session", nil)
+	require.NoError(t, err)
+	recorder.recordUnmatchedRequest(req, time.Now())
+
+	err = verifyInOrder(recorder, false, Request().POST("/session"), Request().GET("/data"))
+	if assert.Error(t, err) {
+		assert.Equal(t, ""+
+			"requests were not received in order\n"+
+			"expected:\n"+
+			"   1: Method(POST),Path(/session)\n"+
+			"   2: Method(GET),Path(/data)\n"+
+			"actual  :\n"+
+			"   1: GET /data?page=1 (accepted)\n"+
+			"   2: POST /session (unmatched)\n", err.Error())
+	}
+	err = verifyInOrder(recorder, true, Request().POST("/session"), Request().GET("/data"))
+	if assert.Error(t, err) {
+		assert.Regexp(t, regexp.MustCompile(`^requests were not received in strict order \(with no other requests in between\)\n`), err.Error())
+	}
+}
+
+func TestVerifyNoMoreInteractions(t *testing.T) {
+	recorder := newRequestRecorder()
+	assert.NoError(t, verifyNoMoreInteractions(recorder), "no requests were expected to be verified")
+
+	for _, url := range []string{"http://host/foo", "http://host/bar", "http://host/foo", "http://host/baz"} {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		if url == "http://host/baz" {
+			recorder.recordUnmatchedRequest(req, time.Now())
+		} else {
+			recorder.recordAcceptedRequest(req, time.Now(), 0, nil)
+		}
+	}
+	err := verifyNoMoreInteractions(recorder)
+	if assert.Error(t, err) {
+		assert.Equal(t, ""+
+			"found 4 unverified requests:\n"+
+			"   1: GET /foo (accepted)\n"+
+			"   2: GET /bar (accepted)\n"+
+			"   3: GET /foo (accepted)\n"+
+			"   4: GET /baz (unmatched)\n", err.Error())
+	}
+
+	// failed verification does not mark requests as verified
+	assert.Error(t, newVerifier(Request().GET("/foo"), Once()).verifyRequests(recorder))
+	assert.NoError(t, newVerifier(Request().GET("/foo"), Times(2)).verifyRequests(recorder))
+	assert.NoError(t, newVerifier(Request().GET("/nothing"), Never()).verifyRequests(recorder))
+	err = verifyNoMoreInteractions(recorder)
+	if assert.Error(t, err) {
+		assert.Equal(t, ""+
+			"found 2 unverified requests:\n"+
+			"   1: GET /bar (accepted)\n"+
+			"   2: GET /baz (unmatched)\n", err.Error())
+	}
+
+	assert.Error(t, verifyInOrder(recorder, true, Request().GET("/bar"), Request().GET("/baz")))
+	assert.Error(t, verifyNoMoreInteractions(recorder))
+	assert.NoError(t, verifyInOrder(recorder, false, Request().GET("/bar"), Request().GET("/baz")))
+	assert.NoError(t, verifyNoMoreInteractions(recorder))
+
+	recorder.ClearHistory()
+	assert.NoError(t, verifyNoMoreInteractions(recorder))
+}
+
+type customServerEndpoint struct {
+	http.HandlerFunc
+}
+
+func (e customServerEndpoint) Matches(request *http.Request) bool {
+	return true
+}
+
+func TestVerifyExpectations(t *testing.T) {
+	met := NewServerEndpoint().When(Request().GET("/foo")).Expect(Never())
+	unmet := NewServerEndpoint().When(Request().GET("/bar")).Expect()
+	err := verifyExpectations([]expectationVerifier{
+		expectationVerifierOf(met),
+		expectationVerifierOf(customServerEndpoint{}),
+		expectationVerifierOf(unmet),
+	})
+	if assert.Error(t, err) {
+		assert.Regexp(t, regexp.MustCompile(`^1 endpoints did not meet their expectations:\n   3: Request\(Method\(GET\),Path\(/bar\)\) - .*expected: 1, actual: 0$`), err.Error())
+	}
+	assert.NoError(t, verifyExpectations([]expectationVerifier{expectationVerifierOf(met)}))
+}